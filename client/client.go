@@ -3,6 +3,8 @@ package main
 import (
 	"GoFTP/constant"
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,10 +12,12 @@ import (
 	"log"
 	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 const (
@@ -25,9 +29,17 @@ const (
 var dataConn net.Conn // 数据连接
 var pasvReady = make(chan bool, 1)
 
+var replies = make(chan string, 1) // 需要同步等待的服务端回应
+var waitingReply atomic.Bool
+
 func main() {
-	var serverAddr string
+	var serverAddr, certFile, keyFile, caFile string
+	var useTLS bool
 	flag.StringVar(&serverAddr, "s", "", "Server address to connect to")
+	flag.BoolVar(&useTLS, "tls", false, "Protect the control connection with AUTH TLS")
+	flag.StringVar(&certFile, "cert", "", "Client certificate file for certificate login")
+	flag.StringVar(&keyFile, "key", "", "Client private key file")
+	flag.StringVar(&caFile, "ca", "", "CA bundle used to verify the server certificate")
 	flag.Parse()
 
 	if serverAddr == "" {
@@ -46,6 +58,20 @@ func main() {
 	log.Println("Connected to server!")
 
 	reader := bufio.NewReader(conn)
+	if useTLS {
+		tlsConfig, err := loadTLSConfig(serverAddr, certFile, keyFile, caFile)
+		if err != nil {
+			log.Println("Error loading TLS config:", err)
+			os.Exit(1)
+		}
+		conn, reader, err = startTLS(conn, reader, tlsConfig)
+		if err != nil {
+			log.Println("Error negotiating TLS:", err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+		log.Println("Control connection protected by TLS.")
+	}
 	go readServerResponses(reader)
 
 	scanner := bufio.NewScanner(os.Stdin)
@@ -80,6 +106,16 @@ func main() {
 			doSTOR(conn, args)
 		case constant.RETR:
 			doRETR(conn, args)
+		case constant.DELE:
+			doDELE(conn, args)
+		case constant.RMD:
+			doRMD(conn, args)
+		case constant.TRASH:
+			doTRASH(conn, args)
+		case constant.PASSWD:
+			doPASSWD(conn)
+		case constant.SITE:
+			doSITE(conn, args)
 		}
 		fmt.Print("> ")
 	}
@@ -92,16 +128,21 @@ func readServerResponses(reader *bufio.Reader) {
 		msg, err := reader.ReadString('\n')
 		if err != nil {
 			log.Println("Server disconnected or error reading:", err)
+			close(replies)
 			return
 		}
 		fmt.Print("<- Server: " + msg)
 
+		if waitingReply.CompareAndSwap(true, false) {
+			replies <- msg
+		}
+
 		if strings.HasPrefix(msg, string(constant.EnteringPassiveMode)) {
 			ip, port, err := parsePASVResponse(msg)
 			if err != nil {
 				log.Println("Error parsing PASV response:", err)
 			} else {
-				dataConn, err = net.Dial("tcp", fmt.Sprintf("%s:%d", ip, port))
+				dataConn, err = net.Dial("tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
 				if err != nil {
 					log.Println("Error establishing data connection:", err)
 					pasvReady <- false
@@ -122,7 +163,7 @@ func sendToServer(conn net.Conn, messages ...string) {
 	} else {
 		_, err := fmt.Fprint(conn, strings.Join(messages, " ")+"\r\n")
 		if err != nil {
-			log.Printf("Error sent message to server! " + err.Error())
+			log.Println("Error sent message to server! " + err.Error())
 		}
 	}
 	// 刷新
@@ -136,6 +177,67 @@ func sendToServer(conn net.Conn, messages ...string) {
 	}
 }
 
+// 发送指令并等待服务端回应，连接断开时返回空串
+func requestServer(conn net.Conn, messages ...string) string {
+	waitingReply.Store(true)
+	sendToServer(conn, messages...)
+	return <-replies
+}
+
+// 读取欢迎信息后发送 AUTH TLS，成功则在原连接上完成TLS握手
+func startTLS(conn net.Conn, reader *bufio.Reader, config *tls.Config) (net.Conn, *bufio.Reader, error) {
+	greeting, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Print("<- Server: " + greeting)
+
+	sendToServer(conn, constant.AUTH, "tls")
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Print("<- Server: " + reply)
+	if !strings.HasPrefix(reply, string(constant.SecurityExchangeOK)) {
+		return nil, nil, errors.New("server refused AUTH TLS")
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, nil, err
+	}
+	return tlsConn, bufio.NewReader(tlsConn), nil
+}
+
+// 构造TLS配置：可选的服务端CA与客户端证书
+func loadTLSConfig(serverAddr, certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: serverAddr,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
 // help
 func doHelp() {
 
@@ -143,24 +245,84 @@ func doHelp() {
 
 // login
 func doLogin(conn net.Conn) {
-	sendToServer(conn, constant.LOGIN)
+	requestServer(conn, constant.LOGIN)
 
-	doUSR(conn)
-	doPASS(conn)
+	// 客户端证书已映射到该账号时无需密码
+	if reply := doUSR(conn); strings.HasPrefix(reply, string(constant.LoginByCertificate)) {
+		return
+	}
+	// 账号启用两步验证时，密码正确后需输入验证码
+	if reply := doPASS(conn); strings.HasPrefix(reply, string(constant.NeedVerifyCode)) {
+		doACCT(conn)
+	}
 }
 
-func doUSR(conn net.Conn) {
+func doUSR(conn net.Conn) string {
 	var username string
 
 	fmt.Scanln(&username)
-	sendToServer(conn, constant.USR, username)
+	return requestServer(conn, constant.USR, username)
 }
 
-func doPASS(conn net.Conn) {
+func doPASS(conn net.Conn) string {
 	var password string
 
 	fmt.Scanln(&password)
-	sendToServer(conn, constant.PASS, password)
+	return requestServer(conn, constant.PASS, password)
+}
+
+func doACCT(conn net.Conn) {
+	var code string
+
+	fmt.Print("Verification code: ")
+	fmt.Scanln(&code)
+	requestServer(conn, constant.ACCT, code)
+}
+
+// 站点扩展指令，例如 site quota
+func doSITE(conn net.Conn, args []string) {
+	if len(args) == 0 {
+		log.Println("Arguments valid, usage: site [command] <args...>")
+		return
+	}
+	sendToServer(conn, append([]string{constant.SITE}, args...)...)
+}
+
+// 修改密码，输入时不回显
+func doPASSWD(conn net.Conn) {
+	oldPassword := readPassword("Old password: ")
+	newPassword := readPassword("New password: ")
+	if readPassword("Retype new password: ") != newPassword {
+		log.Println("Passwords do not match.")
+		return
+	}
+	sendToServer(conn, constant.SITE, constant.PASSWD, oldPassword, newPassword)
+}
+
+// 读取一行输入，终端下关闭回显
+func readPassword(prompt string) string {
+	fmt.Print(prompt)
+	if err := setEcho(false); err == nil {
+		defer func() {
+			_ = setEcho(true)
+			fmt.Println()
+		}()
+	}
+
+	var password string
+	fmt.Scanln(&password)
+	return password
+}
+
+// 通过 stty 开关终端回显，非终端或无 stty 时返回错误
+func setEcho(on bool) error {
+	mode := "echo"
+	if !on {
+		mode = "-echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
 }
 
 func doPASV(conn net.Conn) {
@@ -179,6 +341,31 @@ func doPWD(conn net.Conn) {
 	sendToServer(conn, constant.PWD)
 }
 
+func doDELE(conn net.Conn, args []string) {
+	if len(args) != 1 || len(args[0]) == 0 {
+		log.Println("Arguments valid, usage: dele [file_path]")
+		return
+	}
+	sendToServer(conn, constant.DELE, args[0])
+}
+
+func doRMD(conn net.Conn, args []string) {
+	if len(args) != 1 || len(args[0]) == 0 {
+		log.Println("Arguments valid, usage: rmd [dir_path]")
+		return
+	}
+	sendToServer(conn, constant.RMD, args[0])
+}
+
+// 回收站：trash、trash restore [id]、trash empty
+func doTRASH(conn net.Conn, args []string) {
+	if len(args) > 2 {
+		log.Println("Arguments valid, usage: trash <list | restore [id] | empty>")
+		return
+	}
+	sendToServer(conn, append([]string{constant.SITE, constant.TRASH}, args...)...)
+}
+
 // args: [filePath] <limit> <page>
 func doLIST(conn net.Conn, args []string) {
 	// 1. 进入被动模式
@@ -260,9 +447,11 @@ func doSTOR(conn net.Conn, args []string) {
 	log.Printf("%d bytes sent.", n)
 }
 
+// args: [remoteFilePath] <-c>，-c 表示续传已下载的同名文件
 func doRETR(conn net.Conn, args []string) {
-	if len(args) != 1 {
-		log.Println("Usage: stor <local_file_path>")
+	resume := len(args) == 2 && args[1] == "-c"
+	if len(args) != 1 && !resume {
+		log.Println("Usage: retr <remote_file_path> [-c]")
 		return
 	}
 
@@ -292,23 +481,33 @@ func doRETR(conn net.Conn, args []string) {
 	// 重置全局数据连接
 	defer func() { dataConn = nil }()
 
-	// 3. 发送 RETR 指令
-	sendToServer(conn, constant.RETR, targetFilePath)
-
-	// 4. 文件重命名防止重复
-	downloadFilePath, err = reNameFilePath(downloadFilePath)
-	if err != nil {
-		log.Println("Error renaming file:", err)
+	// 3. 续传时从本地文件末尾继续，否则重命名防止重复并创建新文件
+	var file *os.File
+	if info, statErr := os.Stat(downloadFilePath); resume && statErr == nil {
+		// 服务端未接受断点时从头重新下载，避免在本地文件后追加完整内容
+		flag := os.O_WRONLY | os.O_APPEND
+		if reply := requestServer(conn, constant.REST, strconv.FormatInt(info.Size(), 10)); !strings.HasPrefix(reply, string(constant.FileActionPending)) {
+			log.Println("Server refused to resume, downloading from the beginning.")
+			flag = os.O_WRONLY | os.O_TRUNC
+		}
+		file, err = os.OpenFile(downloadFilePath, flag, 0644)
+	} else {
+		downloadFilePath, err = reNameFilePath(downloadFilePath)
+		if err != nil {
+			log.Println("Error renaming file:", err)
+		}
+		file, err = os.Create(downloadFilePath)
 	}
-
-	// 5. 创建新文件
-	file, err := os.Create(downloadFilePath)
 	if err != nil {
 		log.Println("Error creating file:", err)
+		return
 	}
 	defer file.Close()
 
-	// 6. 接收数据
+	// 4. 发送 RETR 指令
+	sendToServer(conn, constant.RETR, targetFilePath)
+
+	// 5. 接收数据
 	n, err := io.Copy(file, dataConn)
 	if err != nil {
 		log.Println("Error receiving file data:", err)
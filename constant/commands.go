@@ -6,6 +6,9 @@ const (
 	// HELP 查看指令用法
 	HELP = "help"
 
+	// AUTH 协商安全机制（TLS）
+	AUTH = "auth"
+
 	// LOGIN 登录
 	LOGIN = "login"
 
@@ -15,6 +18,9 @@ const (
 	// PASS 密码
 	PASS = "password"
 
+	// ACCT 两步验证码
+	ACCT = "acct"
+
 	// PASV 被动模式
 	PASV = "passive"
 
@@ -27,9 +33,42 @@ const (
 	// LIST 获取子目录或文件列表
 	LIST = "list"
 
+	// REST 指定下载的起始位置（断点续传）
+	REST = "rest"
+
 	// STOR 上传文件
 	STOR = "stor"
 
 	// RETR 下载文件
 	RETR = "retr"
+
+	// DELE 删除文件
+	DELE = "dele"
+
+	// RMD 删除目录
+	RMD = "rmd"
+
+	// SITE 站点扩展指令
+	SITE = "site"
+
+	// PASSWD 修改密码（SITE 子指令）
+	PASSWD = "passwd"
+
+	// QUOTA 查看存储配额（SITE 子指令）
+	QUOTA = "quota"
+
+	// VERSIONS 查看文件历史版本（SITE 子指令）
+	VERSIONS = "versions"
+
+	// RESTORE 恢复文件历史版本（SITE 子指令）
+	RESTORE = "restore"
+
+	// TRASH 回收站（SITE 子指令）
+	TRASH = "trash"
+
+	// EMPTY 清空回收站（SITE TRASH 子指令）
+	EMPTY = "empty"
+
+	// RELOAD 重新加载服务端配置（SITE 子指令，仅管理员）
+	RELOAD = "reload"
 )
@@ -9,17 +9,29 @@ const (
 	ServiceReady          = "220"
 	ClosingDataConnection = "226"
 	EnteringPassiveMode   = "227"
+	LoginByCertificate    = "232"
+	SecurityExchangeOK    = "234"
 	FileCommandRunSuccess = "250"
 
-	NeedPassword = "331"
-	NeedUsername = "332"
+	NeedPassword      = "331"
+	NeedUsername      = "332"
+	NeedVerifyCode    = "336"
+	FileActionPending = "350"
 
-	CannotOpenDataConnection = "425"
-	TransferAborted          = "426"
+	ServiceNotAvailable         = "421"
+	CannotOpenDataConnection    = "425"
+	TransferAborted             = "426"
+	SecurityResourceUnavailable = "431"
+	FileBusy                    = "450"
+	LocalProcessingError        = "451"
 
-	CommandNotDefine = "500"
-	CommandArgsError = "501"
-	NotLogin         = "530"
-	NeedAccount      = "532"
-	PathInvalid      = "550"
+	CommandNotDefine        = "500"
+	CommandArgsError        = "501"
+	CommandNotImplemented   = "502"
+	BadSequence             = "503"
+	ParameterNotImplemented = "504"
+	NotLogin                = "530"
+	NeedAccount             = "532"
+	PathInvalid             = "550"
+	ExceededStorage         = "552"
 )
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// AdminAPI 管理接口（HTTP/JSON）：查看与断开在线会话，管理认证后端中的账号、配额与两步验证。
+// 配置了令牌时要求 Authorization: Bearer <token>，否则只接受本机请求
+type AdminAPI struct {
+	sessions *SessionRegistry
+	reloader *Reloader
+	quota    *QuotaManager
+}
+
+func NewAdminAPI(sessions *SessionRegistry, reloader *Reloader, quota *QuotaManager) *AdminAPI {
+	return &AdminAPI{sessions: sessions, reloader: reloader, quota: quota}
+}
+
+// AccountInfo 账号概况，不含口令哈希与两步验证密钥
+type AccountInfo struct {
+	Username   string  `json:"username"`
+	Role       string  `json:"role"`
+	Home       string  `json:"home"` // 存储驱动中的主目录
+	Quota      int64   `json:"quota"`
+	QuotaFiles int64   `json:"quota_files"`
+	Mounts     []Mount `json:"mounts,omitempty"`
+	TOTP       bool    `json:"totp"`
+	UsedBytes  *int64  `json:"used_bytes,omitempty"` // 仅查询单个账号时给出
+	UsedFiles  *int64  `json:"used_files,omitempty"`
+}
+
+// TOTPEnrollment 新生成的两步验证密钥，只在开启时返回一次
+type TOTPEnrollment struct {
+	Secret string `json:"secret"` // base32 密钥
+	URI    string `json:"uri"`    // 供认证器应用扫描的 otpauth 链接
+}
+
+// 新增或修改账号的请求，修改时未给出的字段保持不变
+type accountRequest struct {
+	Username   string  `json:"username"`
+	Password   *string `json:"password"`
+	Role       *string `json:"role"`
+	Home       *string `json:"home"`
+	Quota      *int64  `json:"quota"`
+	QuotaFiles *int64  `json:"quota_files"`
+}
+
+// Handler 管理接口的路由
+func (a *AdminAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", a.listSessions)
+	mux.HandleFunc("DELETE /sessions/{id}", a.kickSession)
+	mux.HandleFunc("GET /users", a.listUsers)
+	mux.HandleFunc("POST /users", a.createUser)
+	mux.HandleFunc("GET /users/{name}", a.getUser)
+	mux.HandleFunc("PATCH /users/{name}", a.updateUser)
+	mux.HandleFunc("DELETE /users/{name}", a.deleteUser)
+	mux.HandleFunc("POST /users/{name}/totp", a.enrollTOTP)
+	mux.HandleFunc("DELETE /users/{name}/totp", a.disableTOTP)
+	return a.authorize(mux)
+}
+
+// ListenAndServe 在 addr 上提供管理接口
+func (a *AdminAPI) ListenAndServe(addr string) {
+	slog.Info("Serving admin API", "addr", addr)
+	if err := http.ListenAndServe(addr, a.Handler()); err != nil {
+		slog.Error("Admin API listener failed", "err", err)
+	}
+}
+
+// 校验令牌；未配置令牌时只允许本机访问。
+// 管理接口不供浏览器使用，带 Origin 的请求一律拒绝，以免本机网页跨站伪造请求
+func (a *AdminAPI) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+			return
+		}
+		token := a.reloader.Current().config.Admin.Token
+		if token != "" {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+				return
+			}
+		} else if !isLoopback(r.RemoteAddr) {
+			writeError(w, http.StatusForbidden, "admin API only accepts local requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 列出在线会话
+func (a *AdminAPI) listSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := a.sessions.List()
+	infos := make([]SessionInfo, len(sessions))
+	for i, c := range sessions {
+		infos[i] = c.Info()
+	}
+	slices.SortFunc(infos, func(x, y SessionInfo) int { return x.Connected.Compare(y.Connected) })
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// 断开会话
+func (a *AdminAPI) kickSession(w http.ResponseWriter, r *http.Request) {
+	c := a.sessions.Get(r.PathValue("id"))
+	if c == nil {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	c.kick()
+	c.log().Info("Session kicked by admin API")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 列出账号
+func (a *AdminAPI) listUsers(w http.ResponseWriter, r *http.Request) {
+	manager, ok := a.userManager(w)
+	if !ok {
+		return
+	}
+	accounts := manager.Accounts()
+	infos := make([]AccountInfo, len(accounts))
+	for i := range accounts {
+		infos[i] = accountInfo(&accounts[i])
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// 查询账号及其存储用量
+func (a *AdminAPI) getUser(w http.ResponseWriter, r *http.Request) {
+	manager, ok := a.userManager(w)
+	if !ok {
+		return
+	}
+	account := findAccount(manager, r.PathValue("name"))
+	if account == nil {
+		writeError(w, http.StatusNotFound, ErrUserNotFound.Error())
+		return
+	}
+
+	info := accountInfo(account)
+	if bytes, files, err := a.quota.Usage(account.HomeDir()); err == nil {
+		info.UsedBytes, info.UsedFiles = &bytes, &files
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// 新增账号
+func (a *AdminAPI) createUser(w http.ResponseWriter, r *http.Request) {
+	manager, ok := a.userManager(w)
+	if !ok {
+		return
+	}
+	var req accountRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Username == "" || strings.ContainsAny(req.Username, "/\\ ") {
+		writeError(w, http.StatusBadRequest, "invalid username")
+		return
+	}
+	if req.Password == nil {
+		writeError(w, http.StatusBadRequest, "password is required")
+		return
+	}
+
+	account := Account{Username: req.Username, Role: RoleUser}
+	if err := a.apply(&account, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err := manager.CreateAccount(account, *req.Password)
+	if errors.Is(err, ErrUserExists) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	slog.Info("User created by admin API", "user", account.Username, "role", account.Role)
+	writeJSON(w, http.StatusCreated, accountInfo(&account))
+}
+
+// 修改账号的口令、角色、主目录或配额
+func (a *AdminAPI) updateUser(w http.ResponseWriter, r *http.Request) {
+	manager, ok := a.userManager(w)
+	if !ok {
+		return
+	}
+	var req accountRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	username := r.PathValue("name")
+	if req.Username != "" && req.Username != username {
+		writeError(w, http.StatusBadRequest, "username cannot be changed")
+		return
+	}
+	changer, canChange := manager.(PasswordChanger)
+	if req.Password != nil && !canChange {
+		writeError(w, http.StatusNotImplemented, "password change is not supported by the authentication backend")
+		return
+	}
+
+	var updated Account
+	err := manager.UpdateAccount(username, func(account *Account) error {
+		if err := a.apply(account, &req); err != nil {
+			return badRequest{err}
+		}
+		updated = *account
+		return nil
+	})
+	if err == nil && req.Password != nil {
+		err = changer.ChangePassword(username, *req.Password)
+	}
+	var bad badRequest
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.As(err, &bad):
+		writeError(w, http.StatusBadRequest, bad.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	slog.Info("User updated by admin API", "user", username)
+	writeJSON(w, http.StatusOK, accountInfo(&updated))
+}
+
+// 删除账号，已登录的会话不受影响，可另行断开
+func (a *AdminAPI) deleteUser(w http.ResponseWriter, r *http.Request) {
+	manager, ok := a.userManager(w)
+	if !ok {
+		return
+	}
+	username := r.PathValue("name")
+	err := manager.DeleteAccount(username)
+	if errors.Is(err, ErrUserNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	slog.Info("User deleted by admin API", "user", username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 为用户存储中的账号生成两步验证密钥，已开启时替换原密钥。
+// 经运行中的服务端写入，避免另一进程改写用户文件后被本进程的下一次保存覆盖
+func (a *AdminAPI) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("name")
+	secret, err := newTOTPSecret()
+	if err == nil {
+		err = a.reloader.users.SetTOTPSecret(username, secret)
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	slog.Info("TOTP enrolled by admin API", "user", username)
+	writeJSON(w, http.StatusOK, TOTPEnrollment{Secret: secret, URI: totpURI(username, secret)})
+}
+
+// 关闭账号的两步验证
+func (a *AdminAPI) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("name")
+	err := a.reloader.users.SetTOTPSecret(username, "")
+	if errors.Is(err, ErrUserNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	slog.Info("TOTP disabled by admin API", "user", username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 当前认证后端需支持账号管理，否则回应 501
+func (a *AdminAPI) userManager(w http.ResponseWriter) (UserManager, bool) {
+	manager, ok := a.reloader.Current().auth.(UserManager)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "user management is not supported by the authentication backend")
+	}
+	return manager, ok
+}
+
+// 校验请求中的字段并写入账号，口令另行设置
+func (a *AdminAPI) apply(account *Account, req *accountRequest) error {
+	if req.Password != nil {
+		if err := a.reloader.Current().config.Password.Validate(account.Username, *req.Password); err != nil {
+			return fmt.Errorf("password rejected: %w", err)
+		}
+	}
+	if req.Role != nil {
+		if *req.Role != RoleAdmin && *req.Role != RoleUser {
+			return fmt.Errorf("unknown role %q", *req.Role)
+		}
+		account.Role = *req.Role
+	}
+	if req.Home != nil {
+		if *req.Home != "" && isReservedPath(path.Join("/", *req.Home)) {
+			return errors.New("home must not be a reserved path")
+		}
+		account.Home = *req.Home
+	}
+	if req.Quota != nil {
+		if *req.Quota < 0 {
+			return errors.New("quota must not be negative")
+		}
+		account.Quota = *req.Quota
+	}
+	if req.QuotaFiles != nil {
+		if *req.QuotaFiles < 0 {
+			return errors.New("quota_files must not be negative")
+		}
+		account.QuotaFiles = *req.QuotaFiles
+	}
+	return nil
+}
+
+// 请求内容有误，回应 400
+type badRequest struct{ error }
+
+func findAccount(manager UserManager, username string) *Account {
+	for _, account := range manager.Accounts() {
+		if account.Username == username {
+			return &account
+		}
+	}
+	return nil
+}
+
+func accountInfo(account *Account) AccountInfo {
+	return AccountInfo{
+		Username:   account.Username,
+		Role:       account.Role,
+		Home:       account.HomeDir(),
+		Quota:      account.Quota,
+		QuotaFiles: account.QuotaFiles,
+		Mounts:     account.Mounts,
+		TOTP:       account.TOTPSecret != "",
+	}
+}
+
+// 读取请求中的 JSON，要求 Content-Type 为 application/json（浏览器跨站表单无法不经预检发送）
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		slog.Warn("Write admin API response failed", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// 地址是否为本机回环地址，addr 可带端口
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
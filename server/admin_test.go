@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestAdminAPI(t *testing.T) (http.Handler, *UserStore) {
+	t.Helper()
+	users, err := LoadUserStore(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	reloader, err := NewReloader(&cfg, nil, users, NewLockManager(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAdminAPI(NewSessionRegistry(), reloader, nil).Handler(), users
+}
+
+// 以本机地址发送请求
+func adminRequest(handler http.Handler, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminEnrollTOTP(t *testing.T) {
+	handler, users := newTestAdminAPI(t)
+
+	rec := adminRequest(handler, http.MethodPost, "/users/admin/totp")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enroll = %d %s", rec.Code, rec.Body)
+	}
+	var enrollment TOTPEnrollment
+	if err := json.Unmarshal(rec.Body.Bytes(), &enrollment); err != nil || enrollment.Secret == "" {
+		t.Fatalf("enroll response %s: %v", rec.Body, err)
+	}
+	key, _ := totpEncoding.DecodeString(enrollment.Secret)
+	if !verifyTOTP("admin", users.TOTPSecret("admin"), totpCode(key, time.Now().Unix()/totpPeriod)) {
+		t.Error("code from the enrolled secret rejected")
+	}
+
+	// 之后经同一进程保存用户文件不会丢失密钥
+	if err := users.ChangePassword("admin", "Another-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := users.TOTPSecret("admin"); got != enrollment.Secret {
+		t.Errorf("secret on disk = %q, want %q", got, enrollment.Secret)
+	}
+
+	if rec := adminRequest(handler, http.MethodDelete, "/users/admin/totp"); rec.Code != http.StatusNoContent {
+		t.Errorf("disable = %d %s", rec.Code, rec.Body)
+	}
+	if got := users.TOTPSecret("admin"); got != "" {
+		t.Errorf("secret after disable = %q", got)
+	}
+	if rec := adminRequest(handler, http.MethodPost, "/users/nobody/totp"); rec.Code != http.StatusNotFound {
+		t.Errorf("enroll unknown user = %d, want 404", rec.Code)
+	}
+}
+
+// 会话ID重复时不覆盖在线会话，注销后可再次登记
+func TestSessionRegistryRejectsDuplicateID(t *testing.T) {
+	registry := NewSessionRegistry()
+	first, second := &FTPConn{id: "0123456789abcdef"}, &FTPConn{id: "0123456789abcdef"}
+
+	unregister, err := registry.Add(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Add(second); !errors.Is(err, ErrSessionIDInUse) {
+		t.Errorf("Add duplicate err = %v, want ErrSessionIDInUse", err)
+	}
+	if got := registry.Get(first.id); got != first {
+		t.Error("duplicate ID replaced the registered session")
+	}
+
+	unregister()
+	if _, err := registry.Add(second); err != nil {
+		t.Errorf("Add after unregister: %v", err)
+	}
+}
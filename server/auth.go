@@ -0,0 +1,25 @@
+package main
+
+import "errors"
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrUserExists 账号已存在
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotFound 账号不存在
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// Authenticator 认证后端：校验成功返回账号信息，凭据错误返回 ErrInvalidCredentials，其余错误表示后端不可用
+type Authenticator interface {
+	Authenticate(username, password, ip string) (*Account, error)
+}
+
+// UserManager 支持增删改账号的认证后端，供管理接口使用
+type UserManager interface {
+	Accounts() []Account
+	CreateAccount(account Account, password string) error
+	UpdateAccount(username string, update func(*Account) error) error
+	DeleteAccount(username string) error
+}
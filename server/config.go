@@ -0,0 +1,349 @@
+package main
+
+import (
+	"GoFTP/vfs"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Config 服务端配置，可由 JSON 配置文件加载，命令行参数优先于配置文件
+type Config struct {
+	Listen      string `json:"listen"`        // 控制连接监听地址
+	PublicIP    string `json:"public_ip"`     // PASV 模式下通告的公网地址
+	PasvPortMin int    `json:"pasv_port_min"` // 被动模式数据端口范围
+	PasvPortMax int    `json:"pasv_port_max"`
+
+	MetricsListen string `json:"metrics_listen"` // Prometheus 指标的 HTTP 监听地址，为空表示不启用
+
+	Storage        string          `json:"storage"`  // local、memory 或 s3
+	RootDir        string          `json:"root_dir"` // local 驱动的根目录
+	S3             vfs.S3Config    `json:"s3"`
+	Dedup          bool            `json:"dedup"`
+	EncryptionKey  string          `json:"encryption_key"` // 主密钥文件，为空表示不加密
+	Versioning     VersionPolicies `json:"versioning"`
+	TrashRetention Duration        `json:"trash_retention"`
+
+	Users    string         `json:"users"` // 用户存储文件
+	TLS      TLSSettings    `json:"tls"`
+	Auth     AuthSettings   `json:"auth"`
+	Password PasswordPolicy `json:"password"`
+	Limits   LimitSettings  `json:"limits"`
+	Log      LogSettings    `json:"log"`
+	Admin    AdminSettings  `json:"admin"`
+
+	file   string // 配置文件路径与内容，用于定位错误所在行
+	source []byte
+}
+
+// TLSSettings TLS 配置，未指定证书时不启用 AUTH TLS
+type TLSSettings struct {
+	Cert     string `json:"cert"`
+	Key      string `json:"key"`
+	ClientCA string `json:"client_ca"` // 校验客户端证书的 CA，用于证书登录
+	Required bool   `json:"required"`  // 登录前必须先 AUTH TLS
+}
+
+// AuthSettings 认证后端，未指定 Webhook 时使用用户存储
+type AuthSettings struct {
+	Webhook string   `json:"webhook"`
+	Timeout Duration `json:"timeout"`
+	Cache   Duration `json:"cache"`
+}
+
+// LimitSettings 会话限制
+type LimitSettings struct {
+	MaxPassAttempts int      `json:"max_pass_attempts"` // 单个连接允许的最大PASS尝试次数，超出后断开
+	LockWait        Duration `json:"lock_wait"`         // 等待被占用文件的最长时间
+	ShutdownTimeout Duration `json:"shutdown_timeout"`  // 关闭服务端时等待传输完成的最长时间
+
+	MaxSessions        int `json:"max_sessions"`          // 并发会话总数上限，0 表示不限制
+	MaxSessionsPerIP   int `json:"max_sessions_per_ip"`   // 每个来源IP的并发会话上限
+	MaxSessionsPerUser int `json:"max_sessions_per_user"` // 每个账号同时登录的会话上限
+}
+
+// LogSettings 日志输出
+type LogSettings struct {
+	Level  string `json:"level"`  // debug、info、warn 或 error
+	Format string `json:"format"` // text 或 json
+
+	Transfers string `json:"transfers"` // xferlog 格式的传输日志文件，为空表示不记录
+}
+
+// AdminSettings 管理接口，未指定监听地址时不启用
+type AdminSettings struct {
+	Listen string `json:"listen"`
+	Token  string `json:"token"` // Bearer 令牌，监听非本机地址时必须设置；环境变量 GOFTP_ADMIN_TOKEN 优先
+}
+
+// options 仅在启动时使用、不属于配置文件的命令行参数
+type options struct {
+	configFile      string
+	checkConfig     bool
+	encryptExisting bool
+}
+
+// 将命令行参数绑定到配置与启动选项
+func bindFlags(flags *flag.FlagSet, cfg *Config, opts *options) {
+	flags.StringVar(&opts.configFile, "config", "", "JSON configuration file; command-line flags override its values")
+	flags.BoolVar(&opts.checkConfig, "check-config", false, "Validate the configuration, print any errors and exit")
+	flags.StringVar(&cfg.Listen, "listen", cfg.Listen, "Address of the control connection listener")
+	flags.StringVar(&cfg.PublicIP, "ip", cfg.PublicIP, "Public IP address to advertise for PASV mode")
+	flags.IntVar(&cfg.PasvPortMin, "pasv-min", cfg.PasvPortMin, "Lowest port used for PASV data connections")
+	flags.IntVar(&cfg.PasvPortMax, "pasv-max", cfg.PasvPortMax, "Highest port used for PASV data connections")
+	flags.StringVar(&cfg.MetricsListen, "metrics-listen", cfg.MetricsListen, "Address of the HTTP listener serving Prometheus metrics at /metrics, e.g. 127.0.0.1:9121")
+	flags.StringVar(&cfg.Admin.Listen, "admin-listen", cfg.Admin.Listen, "Address of the HTTP admin API; without a token (config or GOFTP_ADMIN_TOKEN) it must be a loopback address")
+	flags.StringVar(&cfg.Users, "users", cfg.Users, "User store file, created with a default admin account if missing")
+	flags.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert, "TLS certificate file, enables AUTH TLS")
+	flags.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "TLS private key file")
+	flags.StringVar(&cfg.TLS.ClientCA, "tls-client-ca", cfg.TLS.ClientCA, "CA bundle used to verify client certificates for certificate login")
+	flags.StringVar(&cfg.Storage, "storage", cfg.Storage, "Storage driver: local, memory or s3")
+	flags.StringVar(&cfg.RootDir, "root", cfg.RootDir, "Root directory of the local storage driver")
+	flags.StringVar(&cfg.EncryptionKey, "encryption-key", cfg.EncryptionKey, "Master key file (64 hex characters, e.g. from openssl rand -hex 32) that enables encryption of stored files")
+	flags.BoolVar(&opts.encryptExisting, "encrypt-existing", false, "Encrypt plaintext files already in the storage with -encryption-key, then exit")
+	flags.BoolVar(&cfg.Dedup, "dedup", cfg.Dedup, "Store identical file contents once by SHA-256 under blobs/ of the storage, with user files kept as references under files/")
+	flags.StringVar(&cfg.S3.Endpoint, "s3-endpoint", cfg.S3.Endpoint, "S3-compatible endpoint URL, credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	flags.StringVar(&cfg.S3.Region, "s3-region", cfg.S3.Region, "S3 region")
+	flags.StringVar(&cfg.S3.Bucket, "s3-bucket", cfg.S3.Bucket, "S3 bucket")
+	flags.StringVar(&cfg.S3.Prefix, "s3-prefix", cfg.S3.Prefix, "Key prefix used as the FTP root inside the bucket")
+	flags.Var(&cfg.Versioning, "versioning", "Keep previous versions of overwritten files under a directory, as <dir>:<keep>[:<retention>] or <dir>:<retention>; repeatable")
+	flags.DurationVar((*time.Duration)(&cfg.TrashRetention), "trash-retention", time.Duration(cfg.TrashRetention), "How long deleted files stay in the trash before being purged, 0 to delete immediately")
+	flags.DurationVar((*time.Duration)(&cfg.Limits.LockWait), "lock-wait", time.Duration(cfg.Limits.LockWait), "How long a command waits for a file busy in another session, 0 to fail immediately with 450")
+	flags.DurationVar((*time.Duration)(&cfg.Limits.ShutdownTimeout), "shutdown-timeout", time.Duration(cfg.Limits.ShutdownTimeout), "How long active transfers may continue after SIGINT/SIGTERM before they are aborted")
+	flags.IntVar(&cfg.Limits.MaxSessions, "max-sessions", cfg.Limits.MaxSessions, "Maximum concurrent sessions, excess connections get 421; 0 for no limit")
+	flags.IntVar(&cfg.Limits.MaxSessionsPerIP, "max-sessions-per-ip", cfg.Limits.MaxSessionsPerIP, "Maximum concurrent sessions from one source IP; 0 for no limit")
+	flags.IntVar(&cfg.Limits.MaxSessionsPerUser, "max-sessions-per-user", cfg.Limits.MaxSessionsPerUser, "Maximum concurrent logged-in sessions of one account; 0 for no limit")
+	flags.IntVar(&cfg.Limits.MaxPassAttempts, "max-pass-attempts", cfg.Limits.MaxPassAttempts, "PASS attempts allowed per connection before it is closed")
+	flags.BoolVar(&cfg.TLS.Required, "require-tls", cfg.TLS.Required, "Refuse to login until the control connection is protected by AUTH TLS")
+	flags.StringVar(&cfg.Auth.Webhook, "auth-webhook", cfg.Auth.Webhook, "HTTP endpoint that authenticates logins instead of the user store")
+	flags.DurationVar((*time.Duration)(&cfg.Auth.Timeout), "auth-webhook-timeout", time.Duration(cfg.Auth.Timeout), "Timeout for auth webhook requests")
+	flags.DurationVar((*time.Duration)(&cfg.Auth.Cache), "auth-webhook-cache", time.Duration(cfg.Auth.Cache), "How long to cache accepted webhook logins, 0 to disable")
+	flags.IntVar(&cfg.Password.MinLength, "passwd-min-length", cfg.Password.MinLength, "Minimum length of passwords set with SITE PASSWD")
+	flags.IntVar(&cfg.Password.MinClasses, "passwd-min-classes", cfg.Password.MinClasses, "Minimum character classes (lower, upper, digit, symbol) in passwords set with SITE PASSWD")
+	flags.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "Minimum level of logged events: debug, info, warn or error")
+	flags.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "Log output format: text or json")
+	flags.StringVar(&cfg.Log.Transfers, "xferlog", cfg.Log.Transfers, "Append an xferlog-format line for every upload and download to this file")
+}
+
+// 解析命令行参数与配置文件：先加载配置文件，再重新解析命令行参数使其覆盖配置文件中的值
+func parseConfig(flags *flag.FlagSet, args []string) (*Config, *options, error) {
+	cfg := DefaultConfig()
+	opts := &options{}
+	bindFlags(flags, &cfg, opts)
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if opts.configFile != "" {
+		cfg = DefaultConfig()
+		if err := cfg.Load(opts.configFile); err != nil {
+			return nil, nil, err
+		}
+		// -versioning 可重复指定，在命令行给出时替换而非追加到配置文件中的列表
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "versioning" {
+				cfg.Versioning = nil
+			}
+		})
+		if err := flags.Parse(args); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 环境变量中的凭据优先于配置文件
+	if key := os.Getenv("AWS_ACCESS_KEY_ID"); key != "" {
+		cfg.S3.AccessKey = key
+		cfg.S3.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if token := os.Getenv("GOFTP_ADMIN_TOKEN"); token != "" {
+		cfg.Admin.Token = token
+	}
+	return &cfg, opts, nil
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() Config {
+	return Config{
+		Listen:         ":21",
+		PasvPortMin:    1024,
+		PasvPortMax:    1048,
+		Storage:        "local",
+		RootDir:        "ftp_root",
+		S3:             vfs.S3Config{Region: "us-east-1"},
+		TrashRetention: Duration(30 * 24 * time.Hour),
+		Users:          "users.json",
+		Auth:           AuthSettings{Timeout: Duration(5 * time.Second), Cache: Duration(time.Minute)},
+		Password:       PasswordPolicy{MinLength: 8, MinClasses: 2},
+		Limits: LimitSettings{
+			MaxPassAttempts: 3,
+			LockWait:        Duration(30 * time.Second),
+			ShutdownTimeout: Duration(30 * time.Second),
+			MaxSessions:     100,
+		},
+		Log: LogSettings{Level: "info", Format: "text"},
+	}
+}
+
+// Load 从 JSON 文件加载配置，未出现的项保持原值；错误信息包含所在行号
+func (c *Config) Load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	c.file, c.source = file, data
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return c.errorAt(syntaxErr.Offset, err.Error())
+		case errors.As(err, &typeErr):
+			return c.errorAt(typeErr.Offset, err.Error())
+		default:
+			// 其余错误（未知字段、取值不合法）不带偏移，按信息中引用的内容定位
+			return c.errorAt(c.offsetOf(err.Error()), err.Error())
+		}
+	}
+	return nil
+}
+
+// Validate 检查配置取值
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, c.errorAt(c.offsetOf(`"`+key+`"`), fmt.Sprintf(key+": "+format, args...)))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(c.Listen)
+	check(err == nil, "listen", "invalid address %q", c.Listen)
+	// PASV 回应只能携带 IPv4 地址
+	if c.PublicIP != "" {
+		addr, err := netip.ParseAddr(c.PublicIP)
+		check(err == nil && addr.Is4(), "public_ip", "must be an IPv4 address, got %q", c.PublicIP)
+	}
+	check(c.PasvPortMin > 0 && c.PasvPortMin <= 65535, "pasv_port_min", "port out of range")
+	check(c.PasvPortMax >= c.PasvPortMin && c.PasvPortMax <= 65535, "pasv_port_max", "must be between pasv_port_min and 65535")
+	if c.MetricsListen != "" {
+		_, _, err := net.SplitHostPort(c.MetricsListen)
+		check(err == nil, "metrics_listen", "invalid address %q", c.MetricsListen)
+	}
+
+	switch c.Storage {
+	case "local":
+		check(c.RootDir != "", "root_dir", "required by local storage")
+	case "memory":
+	case "s3":
+		check(c.S3.Endpoint != "" && c.S3.Bucket != "", "s3", "endpoint and bucket are required by s3 storage")
+	default:
+		check(false, "storage", "unknown storage driver %q", c.Storage)
+	}
+	check(c.TrashRetention >= 0, "trash_retention", "must not be negative")
+
+	check(c.Users != "", "users", "required")
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls", "cert and key must be set together")
+	check(!c.TLS.Required || c.TLS.Cert != "", "required", "needs tls cert and key")
+	if c.Auth.Webhook != "" {
+		u, err := url.Parse(c.Auth.Webhook)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "webhook", "invalid URL %q", c.Auth.Webhook)
+		check(c.Auth.Timeout > 0, "timeout", "must be positive")
+	}
+	check(c.Password.MinLength > 0, "min_length", "must be positive")
+	check(c.Password.MinClasses >= 1 && c.Password.MinClasses <= 4, "min_classes", "must be between 1 and 4")
+	check(c.Limits.MaxPassAttempts > 0, "max_pass_attempts", "must be positive")
+	check(c.Limits.LockWait >= 0, "lock_wait", "must not be negative")
+	check(c.Limits.ShutdownTimeout >= 0, "shutdown_timeout", "must not be negative")
+	check(c.Limits.MaxSessions >= 0, "max_sessions", "must not be negative")
+	check(c.Limits.MaxSessionsPerIP >= 0, "max_sessions_per_ip", "must not be negative")
+	check(c.Limits.MaxSessionsPerUser >= 0, "max_sessions_per_user", "must not be negative")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "level", "unknown log level %q", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "format", "must be text or json")
+	if c.Admin.Listen != "" {
+		_, _, err := net.SplitHostPort(c.Admin.Listen)
+		check(err == nil, "admin", "invalid listen address %q", c.Admin.Listen)
+		check(err != nil || c.Admin.Token != "" || isLoopback(c.Admin.Listen), "admin", "token is required when listening on a non-loopback address")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Check 在 Validate 的基础上检查引用的文件能否读取，供 -check-config 使用
+func (c *Config) Check() error {
+	var errs []error
+	if _, err := loadTLSConfig(c.TLS.Cert, c.TLS.Key, c.TLS.ClientCA); err != nil {
+		errs = append(errs, c.errorAt(c.offsetOf(`"tls"`), "tls: "+err.Error()))
+	}
+	if c.EncryptionKey != "" {
+		if _, err := vfs.ReadKeyFile(c.EncryptionKey); err != nil {
+			errs = append(errs, c.errorAt(c.offsetOf(`"encryption_key"`), "encryption_key: "+err.Error()))
+		}
+	}
+	// 用户存储不存在时会在启动时创建
+	if data, err := os.ReadFile(c.Users); err == nil {
+		if err := json.Unmarshal(data, &UserStore{}); err != nil {
+			errs = append(errs, c.errorAt(c.offsetOf(`"users"`), "users: "+c.Users+": "+err.Error()))
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, c.errorAt(c.offsetOf(`"users"`), "users: "+err.Error()))
+	}
+	return errors.Join(errs...)
+}
+
+// 附带配置文件行号的错误；未加载配置文件或无法定位时不带行号
+func (c *Config) errorAt(offset int64, msg string) error {
+	if c.source == nil {
+		return errors.New(msg)
+	}
+	if offset < 0 {
+		return fmt.Errorf("%s: %s", c.file, msg)
+	}
+	offset = min(offset, int64(len(c.source)))
+	line := bytes.Count(c.source[:offset], []byte("\n")) + 1
+	return fmt.Errorf("%s:%d: %s", c.file, line, msg)
+}
+
+var quotedPattern = regexp.MustCompile(`"[^"]*"`)
+
+// 信息中第一段带引号的内容在配置文件中的偏移，找不到时返回 -1
+func (c *Config) offsetOf(msg string) int64 {
+	quoted := quotedPattern.FindString(msg)
+	if quoted == "" {
+		return -1
+	}
+	return int64(bytes.Index(c.source, []byte(quoted)))
+}
+
+// Duration 配置文件中以 "30s"、"5m" 等字符串表示的时长
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\", got %s", data)
+	}
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(value)
+	return nil
+}
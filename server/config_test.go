@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePublicIP(t *testing.T) {
+	for _, tc := range []struct {
+		ip string
+		ok bool
+	}{
+		{"", true},
+		{"203.0.113.7", true},
+		{"::1", false},
+		{"2001:db8::1", false},
+		{"::ffff:203.0.113.7", false},
+		{"203.0.113", false},
+		{"example.com", false},
+	} {
+		cfg := DefaultConfig()
+		cfg.PublicIP = tc.ip
+		if err := cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("public_ip %q: err = %v, want ok = %v", tc.ip, err, tc.ok)
+		}
+	}
+}
+
+// 配置文件中的错误附带行号
+func TestValidateReportsLine(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte("{\n  \"listen\": \":2121\",\n  \"public_ip\": \"2001:db8::1\"\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	if err := cfg.Load(file); err != nil {
+		t.Fatal(err)
+	}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), file+":3: public_ip: must be an IPv4 address") {
+		t.Errorf("Validate() = %v, want public_ip error on line 3", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// LoginGuard 登录防爆破：按账号与来源IP分别统计失败次数，失败后指数退避，超过阈值临时锁定
+type LoginGuard struct {
+	mu       sync.Mutex
+	accounts map[string]*failureRecord
+	ips      map[string]*failureRecord
+	pruned   time.Time // 上次清理过期记录的时间
+
+	MaxAccountFailures int           // 账号锁定前允许的连续失败次数
+	MaxIPFailures      int           // 来源IP锁定前允许的连续失败次数
+	LockDuration       time.Duration // 锁定时长
+	BaseDelay          time.Duration // 首次失败后的回应延迟，之后每次翻倍
+	MaxDelay           time.Duration // 回应延迟上限
+	ResetAfter         time.Duration // 距上次失败超过该时长则清零计数
+}
+
+type failureRecord struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func NewLoginGuard() *LoginGuard {
+	return &LoginGuard{
+		accounts:           make(map[string]*failureRecord),
+		ips:                make(map[string]*failureRecord),
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		LockDuration:       15 * time.Minute,
+		BaseDelay:          500 * time.Millisecond,
+		MaxDelay:           8 * time.Second,
+		ResetAfter:         30 * time.Minute,
+	}
+}
+
+// Locked 判断账号或来源IP是否处于锁定期，返回解锁时间
+func (g *LoginGuard) Locked(username, ip string) (bool, time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var until time.Time
+	for _, r := range []*failureRecord{g.accounts[username], g.ips[ip]} {
+		if r != nil && now.Before(r.lockedUntil) && r.lockedUntil.After(until) {
+			until = r.lockedUntil
+		}
+	}
+	return !until.IsZero(), until
+}
+
+// Fail 记录一次失败登录，返回本次回应前应等待的时长
+func (g *LoginGuard) Fail(username, ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.prune(now)
+	account := g.record(g.accounts, username, now)
+	source := g.record(g.ips, ip, now)
+
+	if account.failures >= g.MaxAccountFailures && now.After(account.lockedUntil) {
+		account.lockedUntil = now.Add(g.LockDuration)
+		slog.Warn("Account locked after failed logins", "audit", true, "user", username,
+			"until", account.lockedUntil.Format(time.DateTime), "failures", account.failures, "last_ip", ip)
+	}
+	if source.failures >= g.MaxIPFailures && now.After(source.lockedUntil) {
+		source.lockedUntil = now.Add(g.LockDuration)
+		slog.Warn("Source locked after failed logins", "audit", true, "ip", ip,
+			"until", source.lockedUntil.Format(time.DateTime), "failures", source.failures, "last_user", username)
+	}
+
+	failures := max(account.failures, source.failures)
+	delay := g.BaseDelay << min(failures-1, 16)
+	return min(delay, g.MaxDelay)
+}
+
+// Succeed 登录成功后清零账号的失败计数；来源IP的计数随时间自然过期
+func (g *LoginGuard) Succeed(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.accounts, username)
+}
+
+// 取出并更新失败记录，过期的记录会被重置
+func (g *LoginGuard) record(records map[string]*failureRecord, key string, now time.Time) *failureRecord {
+	r, ok := records[key]
+	if !ok || g.expired(r, now) {
+		r = &failureRecord{}
+		records[key] = r
+	}
+	r.failures++
+	r.lastFailure = now
+	return r
+}
+
+// 每隔 ResetAfter 删除已过期且未锁定的记录，避免轮换用户名或来源IP使记录无限增长
+func (g *LoginGuard) prune(now time.Time) {
+	if now.Sub(g.pruned) < g.ResetAfter {
+		return
+	}
+	g.pruned = now
+
+	for _, records := range []map[string]*failureRecord{g.accounts, g.ips} {
+		for key, r := range records {
+			if g.expired(r, now) {
+				delete(records, key)
+			}
+		}
+	}
+}
+
+// 距上次失败已超过 ResetAfter 且不在锁定期
+func (g *LoginGuard) expired(r *failureRecord, now time.Time) bool {
+	return now.Sub(r.lastFailure) > g.ResetAfter && now.After(r.lockedUntil)
+}
+
+// 获取连接的来源IP
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// 超出会话数上限时的错误，同时作为拒绝次数的统计项
+var (
+	ErrServerFull     = errors.New("too many sessions on the server")
+	ErrTooManyFromIP  = errors.New("too many sessions from this address")
+	ErrTooManyForUser = errors.New("too many sessions for this account")
+)
+
+// SessionLimiter 并发会话数限制：全局与每个来源IP在建立连接时检查，每个账号在登录时检查；
+// 上限取自调用时传入的配置，0 表示不限制
+type SessionLimiter struct {
+	mu      sync.Mutex
+	total   int
+	ips     map[string]int
+	users   map[string]int
+	refused map[error]int64 // 各原因被拒绝的次数
+}
+
+func NewSessionLimiter() *SessionLimiter {
+	return &SessionLimiter{
+		ips:     make(map[string]int),
+		users:   make(map[string]int),
+		refused: make(map[error]int64),
+	}
+}
+
+// Open 登记来自 ip 的新连接，返回连接关闭时调用的释放函数
+func (l *SessionLimiter) Open(ip string, limits LimitSettings) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case exceeds(l.total, limits.MaxSessions):
+		return nil, l.refuse(ErrServerFull)
+	case exceeds(l.ips[ip], limits.MaxSessionsPerIP):
+		return nil, l.refuse(ErrTooManyFromIP)
+	}
+	l.total++
+	l.ips[ip]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.total--
+			if l.ips[ip]--; l.ips[ip] == 0 {
+				delete(l.ips, ip)
+			}
+		})
+	}, nil
+}
+
+// Login 登记账号的新会话，返回会话结束时调用的释放函数
+func (l *SessionLimiter) Login(username string, limits LimitSettings) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if exceeds(l.users[username], limits.MaxSessionsPerUser) {
+		return nil, l.refuse(ErrTooManyForUser)
+	}
+	l.users[username]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			if l.users[username]--; l.users[username] == 0 {
+				delete(l.users, username)
+			}
+		})
+	}, nil
+}
+
+// Sessions 当前的会话总数
+func (l *SessionLimiter) Sessions() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.total
+}
+
+// Refused 因 reason（ErrServerFull 等）被拒绝的会话数
+func (l *SessionLimiter) Refused(reason error) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.refused[reason]
+}
+
+// 记录一次拒绝，调用方需持有锁
+func (l *SessionLimiter) refuse(reason error) error {
+	l.refused[reason]++
+	return reason
+}
+
+// 已有 count 个会话时，再增加一个是否超出上限
+func exceeds(count, limit int) bool {
+	return limit > 0 && count >= limit
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFileBusy 文件正被其他会话使用
+var ErrFileBusy = errors.New("file is busy")
+
+// LockManager 跨会话的路径读写锁：读取共享，写入独占；
+// 目录上的写锁（如删除目录）与其下任意文件的锁互斥
+type LockManager struct {
+	mu      sync.Mutex
+	Wait    time.Duration // 路径被占用时的最长等待时间，0 表示立即失败
+	held    map[string]*pathLock
+	changed chan struct{} // 有锁释放时关闭并替换，用于唤醒等待者
+}
+
+type pathLock struct {
+	readers int
+	writer  bool
+}
+
+func NewLockManager(wait time.Duration) *LockManager {
+	return &LockManager{Wait: wait, held: make(map[string]*pathLock), changed: make(chan struct{})}
+}
+
+// SetWait 修改等待时间，对之后的加锁请求生效
+func (m *LockManager) SetWait(wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Wait = wait
+}
+
+// RLock 获取读锁，返回释放函数；等待超时返回 ErrFileBusy
+func (m *LockManager) RLock(name string) (func(), error) {
+	return m.acquire(name, false)
+}
+
+// Lock 获取写锁，返回释放函数；等待超时返回 ErrFileBusy
+func (m *LockManager) Lock(name string) (func(), error) {
+	return m.acquire(name, true)
+}
+
+func (m *LockManager) acquire(name string, write bool) (func(), error) {
+	m.mu.Lock()
+	deadline := time.Now().Add(m.Wait)
+	for m.conflicts(name, write) {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			m.mu.Unlock()
+			return nil, ErrFileBusy
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+		m.mu.Lock()
+	}
+
+	lock := m.held[name]
+	if lock == nil {
+		lock = &pathLock{}
+		m.held[name] = lock
+	}
+	if write {
+		lock.writer = true
+	} else {
+		lock.readers++
+	}
+	m.mu.Unlock()
+
+	var once sync.Once
+	return func() { once.Do(func() { m.release(name, write) }) }, nil
+}
+
+func (m *LockManager) release(name string, write bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock := m.held[name]
+	if write {
+		lock.writer = false
+	} else {
+		lock.readers--
+	}
+	if !lock.writer && lock.readers == 0 {
+		delete(m.held, name)
+	}
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// 是否与已持有的锁冲突；调用方需持有 m.mu
+func (m *LockManager) conflicts(name string, write bool) bool {
+	for held, lock := range m.held {
+		if !isWithin(name, held) && !isWithin(held, name) {
+			continue
+		}
+		if write || lock.writer {
+			return true
+		}
+	}
+	return false
+}
+
+// name 是否为 dir 本身或位于 dir 之下
+func isWithin(name, dir string) bool {
+	return name == dir || dir == "/" || strings.HasPrefix(name, dir+"/")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"GoFTP/constant"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+)
+
+// 日志级别，重新加载配置时生效
+var logLevel slog.LevelVar
+
+// setupLogging 按配置设置默认日志，输出到标准错误
+func setupLogging(settings LogSettings) {
+	_ = logLevel.UnmarshalText([]byte(settings.Level))
+	options := &slog.HandlerOptions{Level: &logLevel}
+
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if settings.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// 记录错误并退出
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// 会话ID，用于关联同一会话的日志；64 位随机数，长期运行也不会重复
+func newSessionID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+// 会话日志，附带会话ID、来源地址与用户名；可在其他协程中调用，不可在持有 mu 时调用
+func (c *FTPConn) log() *slog.Logger {
+	c.mu.Lock()
+	username := c.username
+	c.mu.Unlock()
+
+	if username == "" {
+		return c.logger
+	}
+	return c.logger.With("user", username)
+}
+
+// 参数为口令或验证码的指令
+var secretCommands = []string{constant.PASS, constant.ACCT}
+
+// commandLine 客户端发送的指令，写入日志时隐藏其中的凭据
+type commandLine []string
+
+func (l commandLine) LogValue() slog.Value {
+	fields := slices.Clone(l)
+	secret := len(fields)
+	switch name := strings.ToLower(fields[0]); {
+	case slices.Contains(secretCommands, name):
+		secret = 1
+	case name == constant.SITE && len(fields) > 1 && strings.ToLower(fields[1]) == constant.PASSWD:
+		secret = 2
+	}
+	for i := secret; i < len(fields); i++ {
+		fields[i] = "***"
+	}
+	return slog.StringValue(strings.Join(fields, " "))
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"GoFTP/constant"
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 登录结果
+const (
+	LoginSuccess = "success" // 登录成功
+	LoginFailure = "failure" // 密码或验证码错误
+	LoginLocked  = "locked"  // 账号或来源IP处于锁定期
+	LoginError   = "error"   // 认证后端不可用
+	LoginRefused = "refused" // 账号会话数已满
+)
+
+// 作为指令标签的已知指令，其余指令统计为 other，避免标签数量无限增长
+var metricCommands = []string{
+	constant.AUTH, constant.LOGIN, constant.USR, constant.PASS, constant.ACCT, constant.PASV,
+	constant.CWD, constant.PWD, constant.LIST, constant.REST, constant.STOR, constant.RETR,
+	constant.DELE, constant.RMD, constant.SITE,
+}
+
+// 传输耗时直方图的桶上限（秒）
+var durationBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// Metrics 运行指标，以 Prometheus 文本格式导出
+type Metrics struct {
+	limiter   *SessionLimiter
+	pasvPorts func() int // 当前配置的被动端口数量
+
+	mu        sync.Mutex
+	logins    map[string]int64
+	commands  map[[2]string]int64 // 指令与回应码
+	errors    map[string]int64    // 执行出错的指令
+	transfers map[[2]string]int64 // 方向与完成状态
+	bytes     map[string]int64    // 方向
+	durations map[string]*histogram
+
+	pasvInUse atomic.Int64 // 正在监听的被动端口数
+}
+
+type histogram struct {
+	counts []int64 // 与 durationBuckets 对应，不累计
+	sum    float64
+	count  int64
+}
+
+func NewMetrics(limiter *SessionLimiter, pasvPorts func() int) *Metrics {
+	return &Metrics{
+		limiter:   limiter,
+		pasvPorts: pasvPorts,
+		logins:    make(map[string]int64),
+		commands:  make(map[[2]string]int64),
+		errors:    make(map[string]int64),
+		transfers: make(map[[2]string]int64),
+		bytes:     make(map[string]int64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+// Login 记录一次登录结果
+func (m *Metrics) Login(outcome string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.logins[outcome]++
+}
+
+// Command 记录一条指令及其回应码，执行出错时同时计入错误数
+func (m *Metrics) Command(command string, code constant.Code, err error) {
+	if !slices.Contains(metricCommands, command) {
+		command = "other"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.commands[[2]string{command, string(code)}]++
+	if err != nil {
+		m.errors[command]++
+	}
+}
+
+// Transfer 记录一次上传或下载
+func (m *Metrics) Transfer(incoming bool, bytes int64, duration time.Duration, complete bool) {
+	direction, status := "out", "aborted"
+	if incoming {
+		direction = "in"
+	}
+	if complete {
+		status = "complete"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.transfers[[2]string{direction, status}]++
+	m.bytes[direction] += bytes
+	h := m.durations[direction]
+	if h == nil {
+		h = &histogram{counts: make([]int64, len(durationBuckets))}
+		m.durations[direction] = h
+	}
+	seconds := duration.Seconds()
+	if i, _ := slices.BinarySearch(durationBuckets, seconds); i < len(durationBuckets) {
+		h.counts[i]++
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// TrackPort 统计被动端口占用，返回的监听在关闭时释放计数
+func (m *Metrics) TrackPort(listener net.Listener) net.Listener {
+	m.pasvInUse.Add(1)
+	return &trackedListener{Listener: listener, release: func() { m.pasvInUse.Add(-1) }}
+}
+
+type trackedListener struct {
+	net.Listener
+	once    sync.Once
+	release func()
+}
+
+func (l *trackedListener) Close() error {
+	l.once.Do(l.release)
+	return l.Listener.Close()
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出全部指标
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo 输出全部指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	metricHeader(&b, "goftp_sessions_active", "gauge", "Currently connected control sessions.")
+	fmt.Fprintf(&b, "goftp_sessions_active %d\n", m.limiter.Sessions())
+	metricHeader(&b, "goftp_sessions_refused_total", "counter", "Connections refused by session limits.")
+	for _, reason := range []struct {
+		label string
+		err   error
+	}{{"server", ErrServerFull}, {"ip", ErrTooManyFromIP}, {"user", ErrTooManyForUser}} {
+		fmt.Fprintf(&b, "goftp_sessions_refused_total{reason=%q} %d\n", reason.label, m.limiter.Refused(reason.err))
+	}
+
+	metricHeader(&b, "goftp_pasv_ports_in_use", "gauge", "Passive data ports currently listening.")
+	fmt.Fprintf(&b, "goftp_pasv_ports_in_use %d\n", m.pasvInUse.Load())
+	metricHeader(&b, "goftp_pasv_ports", "gauge", "Passive data ports in the configured range.")
+	fmt.Fprintf(&b, "goftp_pasv_ports %d\n", m.pasvPorts())
+
+	m.mu.Lock()
+	metricHeader(&b, "goftp_logins_total", "counter", "Login attempts by outcome.")
+	for _, outcome := range slices.Sorted(maps.Keys(m.logins)) {
+		fmt.Fprintf(&b, "goftp_logins_total{outcome=%q} %d\n", outcome, m.logins[outcome])
+	}
+	metricHeader(&b, "goftp_commands_total", "counter", "Commands by verb and reply code.")
+	for _, key := range slices.SortedFunc(maps.Keys(m.commands), comparePair) {
+		fmt.Fprintf(&b, "goftp_commands_total{command=%q,code=%q} %d\n", key[0], key[1], m.commands[key])
+	}
+	metricHeader(&b, "goftp_command_errors_total", "counter", "Commands that failed with an error, by verb.")
+	for _, command := range slices.Sorted(maps.Keys(m.errors)) {
+		fmt.Fprintf(&b, "goftp_command_errors_total{command=%q} %d\n", command, m.errors[command])
+	}
+	metricHeader(&b, "goftp_transfers_total", "counter", "File transfers by direction and completion status.")
+	for _, key := range slices.SortedFunc(maps.Keys(m.transfers), comparePair) {
+		fmt.Fprintf(&b, "goftp_transfers_total{direction=%q,status=%q} %d\n", key[0], key[1], m.transfers[key])
+	}
+	metricHeader(&b, "goftp_transfer_bytes_total", "counter", "Bytes transferred by direction.")
+	for _, direction := range slices.Sorted(maps.Keys(m.bytes)) {
+		fmt.Fprintf(&b, "goftp_transfer_bytes_total{direction=%q} %d\n", direction, m.bytes[direction])
+	}
+	metricHeader(&b, "goftp_transfer_duration_seconds", "histogram", "Duration of file transfers by direction.")
+	for _, direction := range slices.Sorted(maps.Keys(m.durations)) {
+		h := m.durations[direction]
+		var cumulative int64
+		for i, bound := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "goftp_transfer_duration_seconds_bucket{direction=%q,le=\"%g\"} %d\n", direction, bound, cumulative)
+		}
+		fmt.Fprintf(&b, "goftp_transfer_duration_seconds_bucket{direction=%q,le=\"+Inf\"} %d\n", direction, h.count)
+		fmt.Fprintf(&b, "goftp_transfer_duration_seconds_sum{direction=%q} %g\n", direction, h.sum)
+		fmt.Fprintf(&b, "goftp_transfer_duration_seconds_count{direction=%q} %d\n", direction, h.count)
+	}
+	m.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ListenAndServe 在 addr 上提供 /metrics
+func (m *Metrics) ListenAndServe(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m)
+	slog.Info("Serving metrics", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		slog.Error("Metrics listener failed", "err", err)
+	}
+}
+
+func metricHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func comparePair(a, b [2]string) int {
+	return cmp.Or(strings.Compare(a[0], b[0]), strings.Compare(a[1], b[1]))
+}
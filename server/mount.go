@@ -0,0 +1,84 @@
+package main
+
+import (
+	"GoFTP/vfs"
+	"errors"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// Mount 挂载点：将存储中的 Source 目录挂载到用户视图中的 Path
+type Mount struct {
+	Path     string `json:"path"`
+	Source   string `json:"source"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// 清理挂载点与来源目录的路径，返回是否可用：挂载点不能是根目录，两者都不能位于保留路径下
+func cleanMount(m Mount) (Mount, bool) {
+	m.Path, m.Source = path.Join("/", m.Path), path.Join("/", m.Source)
+	return m, m.Path != "/" && !isReservedPath(m.Path) && !isReservedPath(m.Source)
+}
+
+// 在用户根目录驱动上叠加账号的挂载点，返回实际生效的挂载点
+func mountAll(logger *slog.Logger, fileSystem vfs.FileSystem, home vfs.FileSystem, mounts []Mount) (vfs.FileSystem, []Mount) {
+	if len(mounts) == 0 {
+		return home, nil
+	}
+
+	mfs := vfs.NewMountFS(home)
+	var mounted []Mount
+	for _, m := range mounts {
+		m, ok := cleanMount(m)
+		if !ok {
+			logger.Warn("Ignore invalid mount", "source", m.Source, "path", m.Path)
+			continue
+		}
+		sub, err := vfs.Sub(fileSystem, m.Source)
+		if err != nil {
+			logger.Warn("Mount failed", "source", m.Source, "path", m.Path, "err", err)
+			continue
+		}
+		mfs.Mount(m.Path, sub, m.ReadOnly)
+		mounted = append(mounted, m)
+	}
+	return mfs, mounted
+}
+
+// 用户路径所在的挂载点（取最深的一个）及其在挂载点下的路径
+func (c *FTPConn) mountFor(name string) (*Mount, string) {
+	var found *Mount
+	for i, m := range c.mounts {
+		if (name == m.Path || strings.HasPrefix(name, m.Path+"/")) && (found == nil || len(m.Path) > len(found.Path)) {
+			found = &c.mounts[i]
+		}
+	}
+	if found == nil {
+		return nil, name
+	}
+	return found, path.Join("/", strings.TrimPrefix(name, found.Path))
+}
+
+// 检查用户路径是否可修改：只读挂载点及挂载点本身不可修改
+func (c *FTPConn) checkWritable(name string) error {
+	mount, rest := c.mountFor(name)
+	if mount == nil {
+		return nil
+	}
+	if mount.ReadOnly {
+		return errors.New("permission denied: read-only mount")
+	}
+	if rest == "/" {
+		return errors.New("permission denied: mount point")
+	}
+	return nil
+}
+
+// 用户路径所在的配额统计根目录与适用的账号配额；挂载目录不计入用户配额
+func (c *FTPConn) quotaScope(name string) (string, *Account) {
+	if mount, _ := c.mountFor(name); mount != nil {
+		return mount.Source, &Account{}
+	}
+	return c.root, c.account
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PasswordChanger 支持修改密码的认证后端
+type PasswordChanger interface {
+	ChangePassword(username, password string) error
+}
+
+// PasswordPolicy 密码策略
+type PasswordPolicy struct {
+	MinLength  int `json:"min_length"`  // 最小长度
+	MinClasses int `json:"min_classes"` // 至少包含的字符种类数（小写、大写、数字、符号）
+}
+
+// Validate 检查新密码是否符合策略
+func (p *PasswordPolicy) Validate(username, password string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	if lower+upper+digit+symbol < p.MinClasses {
+		return fmt.Errorf("password must mix at least %d of lowercase, uppercase, digits and symbols", p.MinClasses)
+	}
+
+	if strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errors.New("password must not contain the username")
+	}
+	return nil
+}
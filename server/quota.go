@@ -0,0 +1,209 @@
+package main
+
+import (
+	"GoFTP/vfs"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// ErrQuotaExceeded 超出存储配额
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// QuotaManager 按用户根目录统计存储用量：首次使用时遍历一次目录树，之后随上传与删除增量更新；
+// 任何会话的写入都会计入所有包含该路径的已统计根目录
+type QuotaManager struct {
+	mu    sync.Mutex
+	fs    vfs.FileSystem
+	usage map[string]*quotaUsage // 键为用户根目录
+}
+
+type quotaUsage struct {
+	bytes int64
+	files int64
+}
+
+func NewQuotaManager(fileSystem vfs.FileSystem) *QuotaManager {
+	return &QuotaManager{fs: fileSystem, usage: make(map[string]*quotaUsage)}
+}
+
+// Usage 查询用户根目录的当前用量
+func (q *QuotaManager) Usage(root string) (bytes, files int64, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage, err := q.load(root)
+	if err != nil {
+		return 0, 0, err
+	}
+	return usage.bytes, usage.files, nil
+}
+
+// Update 删除、移动文件等操作后修正 name 所在各根目录的用量
+func (q *QuotaManager) Update(name string, bytes, files int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.apply(name, bytes, files)
+}
+
+// Begin 开始向 name 上传：replaced 为被覆盖文件的大小，isNew 表示新建文件；
+// 账号设有配额时检查其根目录 root 的用量，文件数超出配额返回 ErrQuotaExceeded
+func (q *QuotaManager) Begin(root, name string, account *Account, replaced int64, isNew bool) (*QuotaTracker, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t := &QuotaTracker{q: q, name: name, limit: account.Quota, replaced: replaced, isNew: isNew}
+	if account.Quota > 0 || account.QuotaFiles > 0 {
+		usage, err := q.load(root)
+		if err != nil {
+			return nil, err
+		}
+		if isNew && account.QuotaFiles > 0 && usage.files+1 > account.QuotaFiles {
+			return nil, ErrQuotaExceeded
+		}
+		t.usage = usage
+	}
+
+	// 覆盖时预先扣除旧文件大小，使接近配额的用户仍可覆盖自己的文件
+	var files int64
+	if isNew {
+		files = 1
+	}
+	q.apply(name, -replaced, files)
+	return t, nil
+}
+
+// 将变化计入所有包含 name 的已统计根目录；调用方需持有锁
+func (q *QuotaManager) apply(name string, bytes, files int64) {
+	for root, usage := range q.usage {
+		if root == "/" || name == root || strings.HasPrefix(name, root+"/") {
+			usage.bytes += bytes
+			usage.files += files
+		}
+	}
+}
+
+// 取出用量，首次使用时遍历目录树统计；调用方需持有锁
+func (q *QuotaManager) load(root string) (*quotaUsage, error) {
+	if usage, ok := q.usage[root]; ok {
+		return usage, nil
+	}
+
+	bytes, files, err := diskUsage(q.fs, root)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	usage := &quotaUsage{bytes: bytes, files: files}
+	q.usage[root] = usage
+	return usage, nil
+}
+
+// Reserve 将移入的文件或目录计入用量，超出账号配额时返回 ErrQuotaExceeded
+func (q *QuotaManager) Reserve(root, name string, account *Account, bytes, files int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if account.Quota > 0 || account.QuotaFiles > 0 {
+		usage, err := q.load(root)
+		if err != nil {
+			return err
+		}
+		if (account.Quota > 0 && usage.bytes+bytes > account.Quota) ||
+			(account.QuotaFiles > 0 && usage.files+files > account.QuotaFiles) {
+			return ErrQuotaExceeded
+		}
+	}
+	q.apply(name, bytes, files)
+	return nil
+}
+
+// 统计文件或目录树的字节数与文件数，服务端内部文件不计入
+func diskUsage(fileSystem vfs.FileSystem, name string) (bytes, files int64, err error) {
+	info, err := fileSystem.Stat(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !info.IsDir() {
+		return info.Size(), 1, nil
+	}
+
+	err = vfs.Walk(fileSystem, name, func(name string, entry fs.DirEntry) error {
+		if strings.HasPrefix(entry.Name(), ReservedPrefix) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		bytes += info.Size()
+		files++
+		return nil
+	})
+	return bytes, files, err
+}
+
+// QuotaTracker 跟踪一次上传写入的字节数，写入时即计入用量，超出字节配额则拒绝写入
+type QuotaTracker struct {
+	q        *QuotaManager
+	usage    *quotaUsage // 账号未设配额时为空
+	limit    int64
+	name     string
+	replaced int64
+	isNew    bool
+	written  int64
+}
+
+// Writer 包装写入目标，写入前检查字节配额
+func (t *QuotaTracker) Writer(w io.Writer) io.Writer {
+	return &quotaWriter{w: w, t: t}
+}
+
+// Cancel 上传失败、原文件保持不变时，完全撤销 Begin
+func (t *QuotaTracker) Cancel() {
+	t.q.mu.Lock()
+	defer t.q.mu.Unlock()
+
+	var files int64
+	if t.isNew {
+		files = -1
+	}
+	t.q.apply(t.name, t.replaced-t.written, files)
+}
+
+// 预留 n 字节，n 为负时退回
+func (t *QuotaTracker) reserve(n int64) bool {
+	t.q.mu.Lock()
+	defer t.q.mu.Unlock()
+
+	if t.usage != nil && t.limit > 0 && n > 0 && t.usage.bytes+n > t.limit {
+		return false
+	}
+	t.q.apply(t.name, n, 0)
+	t.written += n
+	return true
+}
+
+type quotaWriter struct {
+	w io.Writer
+	t *QuotaTracker
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	if !w.t.reserve(int64(len(p))) {
+		return 0, ErrQuotaExceeded
+	}
+	n, err := w.w.Write(p)
+	if n < len(p) {
+		w.t.reserve(int64(n - len(p))) // 退回未写入部分
+	}
+	return n, err
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Runtime 由配置构建的会话依赖；新会话取用最新一次加载的值，已建立的会话保持原值
+type Runtime struct {
+	config       *Config
+	auth         Authenticator
+	tlsConfig    *tls.Config  // 为空表示未启用TLS
+	initialState SessionState // 会话初始状态
+}
+
+// Reloader 重新读取配置文件与命令行参数，校验通过后才替换当前的 Runtime
+type Reloader struct {
+	mu      sync.Mutex // 串行化重新加载
+	current atomic.Pointer[Runtime]
+	args    []string     // 启动时的命令行参数，重新加载时仍然覆盖配置文件
+	users   *UserStore   // 用户存储在原处重新加载，已登录会话持有的账号不受影响
+	locks   *LockManager // 等待时间随配置更新
+}
+
+func NewReloader(cfg *Config, args []string, users *UserStore, locks *LockManager) (*Reloader, error) {
+	r := &Reloader{args: args, users: users, locks: locks}
+	runtime, err := r.build(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(runtime)
+	return r, nil
+}
+
+// Current 当前生效的 Runtime
+func (r *Reloader) Current() *Runtime {
+	return r.current.Load()
+}
+
+// Reload 重新加载配置：用户、登录限制、被动端口范围与TLS证书对新会话生效；
+// 存储与监听等需重启才能生效的配置保持原值并记录日志。校验失败时不做任何修改
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flags := flag.NewFlagSet("reload", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	cfg, _, err := parseConfig(flags, r.args)
+	if err != nil {
+		return err
+	}
+	if err := errors.Join(cfg.Validate(), cfg.Check()); err != nil {
+		return err
+	}
+
+	old := r.Current()
+	if fields := keepRestartOnly(cfg, old.config); len(fields) > 0 {
+		slog.Warn("Reloaded settings take effect after restart", "settings", strings.Join(fields, ", "))
+	}
+	runtime, err := r.build(cfg, old)
+	if err != nil {
+		return err
+	}
+	if err := r.users.Reload(); err != nil {
+		return err
+	}
+
+	r.locks.SetWait(time.Duration(cfg.Limits.LockWait))
+	_ = logLevel.UnmarshalText([]byte(cfg.Log.Level))
+	r.current.Store(runtime)
+	slog.Info("Configuration reloaded")
+	return nil
+}
+
+// 按配置构建 Runtime；认证设置未变时沿用原认证后端，保留其缓存
+func (r *Reloader) build(cfg *Config, old *Runtime) (*Runtime, error) {
+	tlsConfig, err := loadTLSConfig(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	runtime := &Runtime{config: cfg, tlsConfig: tlsConfig, initialState: StateConnected}
+	if cfg.TLS.Required {
+		runtime.initialState = StateTLSRequired
+	}
+
+	switch {
+	case old != nil && old.config.Auth == cfg.Auth:
+		runtime.auth = old.auth
+	case cfg.Auth.Webhook != "":
+		runtime.auth = NewWebhookAuthenticator(cfg.Auth.Webhook, time.Duration(cfg.Auth.Timeout), time.Duration(cfg.Auth.Cache))
+	default:
+		// 默认使用本地用户存储认证
+		runtime.auth = r.users
+	}
+	return runtime, nil
+}
+
+// 需重启才能生效的配置恢复为原值，返回其中发生变化的字段
+func keepRestartOnly(cfg, old *Config) []string {
+	var changed []string
+	compare := func(name string, value, oldValue any) {
+		if !reflect.DeepEqual(value, oldValue) {
+			changed = append(changed, name)
+		}
+	}
+	compare("listen", cfg.Listen, old.Listen)
+	compare("metrics_listen", cfg.MetricsListen, old.MetricsListen)
+	compare("admin.listen", cfg.Admin.Listen, old.Admin.Listen)
+	compare("storage", cfg.Storage, old.Storage)
+	compare("root_dir", cfg.RootDir, old.RootDir)
+	compare("s3", cfg.S3, old.S3)
+	compare("dedup", cfg.Dedup, old.Dedup)
+	compare("encryption_key", cfg.EncryptionKey, old.EncryptionKey)
+	compare("versioning", cfg.Versioning, old.Versioning)
+	compare("trash_retention", cfg.TrashRetention, old.TrashRetention)
+	compare("users", cfg.Users, old.Users)
+	compare("log.format", cfg.Log.Format, old.Log.Format)
+	compare("log.transfers", cfg.Log.Transfers, old.Log.Transfers)
+
+	cfg.Listen, cfg.MetricsListen, cfg.Admin.Listen = old.Listen, old.MetricsListen, old.Admin.Listen
+	cfg.Storage, cfg.RootDir, cfg.S3 = old.Storage, old.RootDir, old.S3
+	cfg.Dedup, cfg.EncryptionKey, cfg.Versioning = old.Dedup, old.EncryptionKey, old.Versioning
+	cfg.TrashRetention, cfg.Users = old.TrashRetention, old.Users
+	cfg.Log.Format, cfg.Log.Transfers = old.Log.Format, old.Log.Transfers
+	return changed
+}
@@ -2,122 +2,469 @@ package main
 
 import (
 	"GoFTP/constant"
+	"GoFTP/vfs"
 	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
-)
-
-const (
-	CtrlPort    = "21"
-	PasvPortMin = 1024
-	PasvPortMax = 1048
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 type FTPConn struct {
-	conn         net.Conn     // 连接控制
-	dataConn     net.Conn     // 数据连接
-	dataListener net.Listener // 数据监听
-	rootDir      string       // 根目录
-	workDir      string       // 工作目录
+	id           string          // 会话ID
+	connected    time.Time       // 建立连接的时间
+	ctx          context.Context // 服务端开始关闭时取消
+	mu           sync.Mutex      // 保护 busy、status 以及需从其他协程访问的连接
+	busy         bool            // 正在执行指令
+	status       sessionStatus   // 供管理接口读取的会话状态
+	transfer     net.Conn        // 最近建立的数据连接，强制关闭时中断
+	bytesIn      atomic.Int64    // 本会话累计上传字节数
+	bytesOut     atomic.Int64    // 本会话累计下载字节数
+	conn         net.Conn        // 连接控制
+	dataConn     net.Conn        // 数据连接
+	dataListener net.Listener    // 数据监听
+	fs           vfs.FileSystem  // 存储驱动
+	workDir      string          // 工作目录
 
 	publicIp     string // 公网IP
 	dataConnChan chan net.Conn
 
 	username      string          // 用户名
 	authorisation constant.Status // 授权
+	state         SessionState    // 登录状态
+
+	guard        *LoginGuard // 登录防爆破
+	passAttempts int         // 本连接已尝试的PASS次数
+	closing      bool        // 回应后关闭控制连接
+
+	users          *UserStore      // 用户存储
+	auth           Authenticator   // 认证后端
+	account        *Account        // 登录后的账号信息
+	pendingAccount *Account        // 密码正确、等待两步验证码的账号
+	reader         *bufio.Scanner  // 控制连接读取
+	tlsConfig      *tls.Config     // 为空表示未启用TLS
+	upgradeTLS     bool            // 回应后升级控制连接为TLS
+	certAccount    *Account        // 客户端证书映射的账号
+	passwordPolicy *PasswordPolicy // 修改密码时的密码策略
+	config         *Config         // 服务端配置
+	quota          *QuotaManager   // 存储配额
+	versions       *Versioner      // 历史版本
+	trash          *Trash          // 回收站
+	locks          *LockManager    // 跨会话的文件读写锁
+	reloader       *Reloader       // 重新加载配置
+	limiter        *SessionLimiter // 并发会话数限制
+	logout         func()          // 登录后释放账号会话名额
+	root           string          // 用户根目录在存储驱动中的路径
+	home           vfs.FileSystem  // 以用户根目录为根的驱动，客户端路径均经此访问
+	mounts         []Mount         // 生效的挂载点
+	restOffset     int64           // REST 指定的下一次下载起始位置
+	logger         *slog.Logger    // 附带会话ID与来源地址的日志，经 log() 使用
+	transfers      *TransferLog    // xferlog 传输日志，为空表示不记录
+	metrics        *Metrics        // 运行指标
 }
 
 func main() {
-	var publicIp string
-	flag.StringVar(&publicIp, "ip", "", "Public IP address to advertise for PASV mode")
-	flag.Parse()
+	cfg, opts, err := parseConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fatal("Load config failed", "err", err)
+	}
+	// 配置错误可能有多行，直接输出便于阅读
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid config:\n"+err.Error())
+		os.Exit(1)
+	}
+	if opts.checkConfig {
+		if err := cfg.Check(); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid config:\n"+err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("Configuration OK")
+		return
+	}
+	setupLogging(cfg.Log)
+
+	users, err := LoadUserStore(cfg.Users)
+	if err != nil {
+		fatal("Load user store failed", "err", err)
+	}
+
+	// 用户、认证后端与TLS证书可通过 SIGHUP 或 SITE RELOAD 重新加载
+	locks := NewLockManager(time.Duration(cfg.Limits.LockWait))
+	reloader, err := NewReloader(cfg, os.Args[1:], users, locks)
+	if err != nil {
+		fatal("Load TLS config failed", "err", err)
+	}
 
-	// Create a root directory for the FTP server
-	rootDir := "ftp_root"
-	_, err := os.Stat(rootDir)
-	if os.IsNotExist(err) {
-		// directory not exist, create
-		err := os.Mkdir(rootDir, 0755)
+	// 存储驱动
+	var fileSystem vfs.FileSystem
+	switch cfg.Storage {
+	case "local":
+		// Create a root directory for the FTP server
+		rootDir := cfg.RootDir
+		_, err = os.Stat(rootDir)
+		if os.IsNotExist(err) {
+			// directory not exist, create
+			err := os.Mkdir(rootDir, 0755)
+
+			if err != nil {
+				fatal("Create root directory failed", "err", err)
+			}
+		}
+		fileSystem, err = vfs.NewLocalFS(rootDir)
+		if err != nil {
+			fatal("Open local storage failed", "err", err)
+		}
+	case "memory":
+		fileSystem = vfs.NewMemoryFS()
+	case "s3":
+		fileSystem, err = vfs.NewS3FS(cfg.S3)
+		if err != nil {
+			fatal("Open S3 storage failed", "err", err)
+		}
+	}
 
+	// 加密位于去重之下，使相同内容的明文仍能去重
+	if cfg.EncryptionKey != "" {
+		key, err := vfs.ReadKeyFile(cfg.EncryptionKey)
 		if err != nil {
-			log.Fatal(err)
+			fatal("Load encryption key failed", "err", err)
+		}
+		encrypted, err := vfs.NewEncryptedFS(fileSystem, key)
+		if err != nil {
+			fatal("Open encrypted storage failed", "err", err)
+		}
+		if opts.encryptExisting {
+			n, err := encrypted.EncryptExisting()
+			if err != nil {
+				fatal("Encrypt existing files failed", "err", err)
+			}
+			slog.Info("Encrypted existing files", "count", n)
 			return
 		}
+		fileSystem = encrypted
+	} else if opts.encryptExisting {
+		fatal("-encrypt-existing needs -encryption-key")
 	}
 
+	if cfg.Dedup {
+		fileSystem, err = vfs.NewDedupFS(fileSystem)
+		if err != nil {
+			fatal("Open deduplicating storage failed", "err", err)
+		}
+	}
+
+	cleanupUploads(fileSystem)
+	quota := NewQuotaManager(fileSystem)
+	versions := NewVersioner(fileSystem, cfg.Versioning)
+	trash := NewTrash(fileSystem, time.Duration(cfg.TrashRetention))
+	if trash.Enabled() {
+		go trash.PurgeLoop(time.Hour)
+	}
+
+	// 收到 SIGINT/SIGTERM 后停止接受新连接，并通知各会话
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// 创建控制端口，开启监听
-	listen, err := net.Listen("tcp", ":"+CtrlPort)
+	listen, err := net.Listen("tcp", cfg.Listen)
 	if err != nil {
-		log.Println("Listen failed, err: ", err)
-		return
+		fatal("Listen failed", "err", err)
 	}
 	defer listen.Close()
-	log.Println("Listening on " + publicIp + ":" + CtrlPort)
+	slog.Info("Listening", "addr", listen.Addr().String())
+
+	var transfers *TransferLog
+	if cfg.Log.Transfers != "" {
+		transfers, err = OpenTransferLog(cfg.Log.Transfers)
+		if err != nil {
+			fatal("Open transfer log failed", "err", err)
+		}
+		defer transfers.Close()
+	}
+
+	guard := NewLoginGuard()
+	limiter := NewSessionLimiter()
+	registry := NewSessionRegistry()
+	metrics := NewMetrics(limiter, func() int {
+		config := reloader.Current().config
+		return config.PasvPortMax - config.PasvPortMin + 1
+	})
+	if cfg.MetricsListen != "" {
+		go metrics.ListenAndServe(cfg.MetricsListen)
+	}
+	if cfg.Admin.Listen != "" {
+		go NewAdminAPI(registry, reloader, quota).ListenAndServe(cfg.Admin.Listen)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.Reload(); err != nil {
+				slog.Error("Reload failed, config unchanged", "err", err)
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		listen.Close()
+	}()
 
 	// 持续监听
+	var sessions sync.WaitGroup
 	for {
 		conn, err := listen.Accept()
 		if err != nil {
-			log.Println("Accept failed, err: ", err)
+			if ctx.Err() != nil {
+				break
+			}
+			slog.Warn("Accept failed", "err", err)
 			continue
 		}
-		log.Println("Accepted new connection from ", conn.RemoteAddr())
+		id := newSessionID()
+		logger := slog.With("session", id, "remote", conn.RemoteAddr().String())
 
-		// 新建FTP连接
+		// 新建FTP连接，使用最新加载的配置
+		runtime := reloader.Current()
+		release, err := limiter.Open(remoteIP(conn), runtime.config.Limits)
+		if err != nil {
+			logger.Warn("Connection refused", "err", err)
+			go refuse(conn, logger, err)
+			continue
+		}
+		logger.Info("Connection accepted")
 		ftpConn := &FTPConn{
-			conn:          conn,
-			authorisation: constant.NONE,
-			rootDir:       rootDir,
-			workDir:       "/",
-			publicIp:      publicIp,
-			dataConnChan:  make(chan net.Conn, 1),
+			id:             id,
+			connected:      time.Now(),
+			status:         sessionStatus{dir: "/"},
+			ctx:            ctx,
+			conn:           conn,
+			authorisation:  constant.NONE,
+			state:          runtime.initialState,
+			fs:             fileSystem,
+			workDir:        "/",
+			publicIp:       runtime.config.PublicIP,
+			dataConnChan:   make(chan net.Conn, 1),
+			guard:          guard,
+			users:          users,
+			auth:           runtime.auth,
+			tlsConfig:      runtime.tlsConfig,
+			passwordPolicy: &runtime.config.Password,
+			config:         runtime.config,
+			reloader:       reloader,
+			logger:         logger,
+			transfers:      transfers,
+			metrics:        metrics,
+			quota:          quota,
+			versions:       versions,
+			trash:          trash,
+			locks:          locks,
+			limiter:        limiter,
 		}
-		go ftpConn.handleConnection()
+		unregister, err := registry.Add(ftpConn)
+		if err != nil {
+			logger.Error("Connection refused", "err", err)
+			release()
+			go refuse(conn, logger, err)
+			continue
+		}
+		sessions.Go(func() {
+			defer release()
+			defer unregister()
+			ftpConn.handleConnection()
+		})
 	}
+
+	// 等待会话结束；会话在 ShutdownTimeout 后会强制中断传输
+	slog.Info("Shutting down, waiting for active transfers to finish")
+	done := make(chan struct{})
+	go func() {
+		sessions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Duration(reloader.Current().config.Limits.ShutdownTimeout) + 5*time.Second):
+		slog.Warn("Sessions did not finish in time")
+	}
+	slog.Info("Server stopped")
+}
+
+// 回应 421 后关闭超出会话数上限的连接
+func refuse(conn net.Conn, logger *slog.Logger, reason error) {
+	defer conn.Close()
+
+	msg := "Too many connections, please retry later."
+	switch {
+	case errors.Is(reason, ErrTooManyFromIP):
+		msg = "Too many connections from your address, please retry later."
+	case errors.Is(reason, ErrSessionIDInUse):
+		msg = "Service not available, please retry later."
+	}
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	reply(conn, logger, constant.ServiceNotAvailable, msg)
 }
 
 // 连接处理
 func (c *FTPConn) handleConnection() {
-	defer c.conn.Close()
+	// 升级TLS后 c.conn 会被替换
+	defer func() {
+		c.conn.Close()
+		c.log().Info("Connection closed")
+	}()
+	defer func() {
+		if closer, ok := c.home.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+
+	defer func() {
+		if c.logout != nil {
+			c.logout()
+		}
+	}()
 
 	c.respond(constant.ServiceReady, "Hello from FTP server!")
 
-	scanner := bufio.NewScanner(c.conn)
-	for scanner.Scan() {
-		line := scanner.Text()
+	// 服务端关闭时断开本会话
+	stop := context.AfterFunc(c.ctx, c.shutdown)
+	defer stop()
+
+	c.reader = bufio.NewScanner(c.conn)
+	for c.reader.Scan() {
+		line := c.reader.Text()
 		fields := strings.Fields(line)
 		if len(fields) == 0 {
 			continue
 		}
-		log.Println("<- Get from client: ", strings.Join(fields, " "))
+		c.log().Debug("Command received", "command", commandLine(fields))
 
 		command := strings.ToLower(fields[0])
 		args := fields[1:]
 
+		if !c.begin(command) {
+			return
+		}
 		ok, code, msg, err := c.solve(command, args)
 		if !ok {
-			log.Println("Command running failed, err: ", err)
+			c.log().Warn("Command failed", "command", command, "code", string(code), "err", err)
 		}
 		c.respond(code, msg)
+		if c.closing {
+			return
+		}
+		if c.upgradeTLS {
+			if err := c.startTLS(); err != nil {
+				c.log().Warn("TLS handshake failed", "err", err)
+				return
+			}
+		}
+		if !c.end() {
+			c.respond(constant.ServiceNotAvailable, "Server shutting down.")
+			return
+		}
+	}
+}
+
+// 开始执行指令，服务端正在关闭时返回 false
+func (c *FTPConn) begin(command string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ctx.Err() != nil {
+		return false
+	}
+	c.busy = true
+	c.status.command = command
+	return true
+}
+
+// 指令执行完毕并更新会话状态，服务端正在关闭时返回 false
+func (c *FTPConn) end() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.busy = false
+	c.status.command = ""
+	c.status.user, c.status.dir = c.username, c.workDir
+	return c.ctx.Err() == nil
+}
+
+// 服务端关闭：空闲会话立即回应 421 并断开，正在执行的指令（如传输中的文件）
+// 可在 ShutdownTimeout 内完成，超时后强制中断
+func (c *FTPConn) shutdown() {
+	c.mu.Lock()
+	busy := c.busy
+	c.mu.Unlock()
+
+	if !busy {
+		c.hangUp("Server shutting down.")
+		return
+	}
+	time.AfterFunc(time.Duration(c.config.Limits.ShutdownTimeout), c.abort)
+}
+
+// 从其他协程回应 421 后强制断开；网络写入不持有 mu，且最多等待 5 秒
+func (c *FTPConn) hangUp(msg string) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	reply(conn, c.log(), constant.ServiceNotAvailable, msg)
+	c.abort()
+}
+
+// 强制关闭控制连接与数据连接
+func (c *FTPConn) abort() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.Close()
+	if c.dataListener != nil {
+		c.dataListener.Close()
+	}
+	if c.transfer != nil {
+		c.transfer.Close()
 	}
 }
 
 func (c *FTPConn) solve(command string, args []string) (ok bool, code constant.Code, msg string, err error) {
+	defer func() { c.metrics.Command(command, code, err) }()
+
+	// 按会话状态检查指令是否合法
+	if ok, code, msg := c.checkSequence(command); !ok {
+		return false, code, msg, errors.New("bad sequence of commands")
+	}
+
 	switch command {
+	case constant.AUTH: // 安全机制
+		return c.handleAUTH(args)
 	case constant.LOGIN: // 登录指令
 		return c.handleLogin()
 	case constant.USR: // 用户名
 		return c.handleUsr(args)
 	case constant.PASS: // 密码
 		return c.handlePASS(args)
+	case constant.ACCT: // 两步验证码
+		return c.handleACCT(args)
 	case constant.PASV: // 被动链接
 		return c.handlePASV()
 	case constant.CWD: // 更改工作目录
@@ -126,10 +473,18 @@ func (c *FTPConn) solve(command string, args []string) (ok bool, code constant.C
 		return c.handlePWD()
 	case constant.LIST: // 文件列表
 		return c.handleLIST(args)
+	case constant.REST: // 断点续传
+		return c.handleREST(args)
 	case constant.STOR: // 上传
 		return c.handleSTOR(args)
 	case constant.RETR: // 下载
 		return c.handleRETR(args)
+	case constant.DELE: // 删除文件
+		return c.handleDELE(args)
+	case constant.RMD: // 删除目录
+		return c.handleRMD(args)
+	case constant.SITE: // 站点扩展指令
+		return c.handleSITE(args)
 	default:
 		ok = false
 		err = errors.New("command not recognized")
@@ -139,20 +494,21 @@ func (c *FTPConn) solve(command string, args []string) (ok bool, code constant.C
 
 // 回应
 func (c *FTPConn) respond(code constant.Code, msg string) {
+	reply(c.conn, c.log(), code, msg)
+}
+
+func reply(conn net.Conn, logger *slog.Logger, code constant.Code, msg string) {
 	response := string(code) + " | " + msg + "\r\n"
-	_, err := fmt.Fprint(c.conn, response)
+	_, err := fmt.Fprint(conn, response)
 	if err != nil {
-		log.Println("Respond failed, err: ", err)
+		logger.Warn("Respond failed", "err", err)
 	}
 
-	log.Println("-> Response: " + response)
+	logger.Debug("Response sent", "code", string(code), "msg", msg)
 }
 
 func (c *FTPConn) handleLogin() (ok bool, code constant.Code, msg string, err error) {
-	if c.authorisation != constant.NONE {
-		return false, constant.CommandRunFail, "You have already login, username: " + c.username, nil
-	}
-
+	c.state = StateNeedUsername
 	return true, constant.NeedUsername, "Need username.", nil
 }
 
@@ -162,7 +518,18 @@ func (c *FTPConn) handleUsr(args []string) (ok bool, code constant.Code, msg str
 	}
 
 	username := args[0]
+	c.mu.Lock()
 	c.username = username
+	c.mu.Unlock()
+	c.state = StateNeedPassword
+
+	// 已校验的客户端证书映射到该账号时，无需密码直接登录
+	if c.certAccount != nil && c.certAccount.Username == username {
+		if ok, code, msg, err := c.login(c.certAccount); !ok {
+			return ok, code, msg, err
+		}
+		return true, constant.LoginByCertificate, "Welcome! " + username + " (authorized by certificate)", nil
+	}
 
 	return true, constant.NeedPassword, "Need password.", nil
 }
@@ -172,28 +539,155 @@ func (c *FTPConn) handlePASS(args []string) (ok bool, code constant.Code, msg st
 		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
 	}
 
-	if len(c.username) == 0 {
-		return false, constant.NeedUsername, "Need username.", nil
+	// 锁定期内同样计入本连接的尝试次数
+	c.passAttempts++
+	ip := remoteIP(c.conn)
+	if locked, until := c.guard.Locked(c.username, ip); locked {
+		return c.rejectPASS(LoginLocked, "Too many failed attempts, locked until "+until.Format(time.DateTime))
 	}
-	// TODO 接入数据库
 
 	password := args[0]
-	if c.username == "admin" && password == "123456" {
-		c.authorisation = constant.ADMIN
-		return true, constant.CommandRunSuccess, "Welcome! " + c.username, nil
-	} else {
-		return false, constant.NotLogin, "Username or password error! Please retry", nil
+	secret := c.users.TOTPSecret(c.username)
+	verified := secret == "" // 未启用两步验证视为已通过
+	account, err := c.auth.Authenticate(c.username, password, ip)
+
+	// 启用两步验证的账号可在密码后直接附加验证码
+	if errors.Is(err, ErrInvalidCredentials) && secret != "" && len(password) > totpDigits {
+		prefix, code := password[:len(password)-totpDigits], password[len(password)-totpDigits:]
+		if isTOTPCode(code) {
+			account, err = c.auth.Authenticate(c.username, prefix, ip)
+			if err == nil && !verifyTOTP(c.username, secret, code) {
+				account, err = nil, ErrInvalidCredentials
+			}
+			verified = err == nil
+		}
+	}
+
+	switch {
+	case err == nil && verified:
+		return c.login(account)
+	case err == nil:
+		c.pendingAccount = account
+		c.state = StateNeedCode
+		return true, constant.NeedVerifyCode, "Need verification code.", nil
+	case !errors.Is(err, ErrInvalidCredentials):
+		// 认证后端不可用不计入失败次数
+		c.metrics.Login(LoginError)
+		return false, constant.LocalProcessingError, "Authentication service unavailable, please retry later.", err
 	}
+
+	// 失败后延迟回应，延迟随失败次数指数增长
+	time.Sleep(c.guard.Fail(c.username, ip))
+	return c.rejectPASS(LoginFailure, "Username or password error! Please retry")
 }
 
-// 处理被动链接
-func (c *FTPConn) handlePASV() (ok bool, code constant.Code, msg string, err error) {
-	if c.authorisation == constant.NONE {
-		return false, constant.NotLogin, "You have not login.", nil
+// 校验两步验证码，通过后完成登录
+func (c *FTPConn) handleACCT(args []string) (ok bool, code constant.Code, msg string, err error) {
+	if len(args) != 1 || len(args[0]) == 0 {
+		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
+	}
+
+	c.passAttempts++
+	ip := remoteIP(c.conn)
+	if locked, until := c.guard.Locked(c.username, ip); locked {
+		return c.rejectPASS(LoginLocked, "Too many failed attempts, locked until "+until.Format(time.DateTime))
+	}
+
+	if verifyTOTP(c.username, c.users.TOTPSecret(c.username), args[0]) {
+		return c.login(c.pendingAccount)
+	}
+
+	time.Sleep(c.guard.Fail(c.username, ip))
+	return c.rejectPASS(LoginFailure, "Verification code error! Please retry")
+}
+
+// 登录成功，清零失败计数；账号会话数已满时回应 421 并断开
+func (c *FTPConn) login(account *Account) (bool, constant.Code, string, error) {
+	logout, err := c.limiter.Login(account.Username, c.config.Limits)
+	if err != nil {
+		c.metrics.Login(LoginRefused)
+		c.closing = true
+		return false, constant.ServiceNotAvailable, "Too many sessions for " + account.Username + ", closing control connection.", err
+	}
+	c.logout = logout
+	c.metrics.Login(LoginSuccess)
+
+	c.guard.Succeed(c.username)
+	c.passAttempts = 0
+	c.pendingAccount = nil
+	c.account = account
+	c.authorisation = account.Status()
+	c.state = StateAuthenticated
+	c.log().Info("Logged in")
+	return true, constant.CommandRunSuccess, "Welcome! " + c.username, nil
+}
+
+// 拒绝本次PASS并按 outcome 计入登录指标，需从 login 重新开始；超过单连接尝试上限时断开连接
+func (c *FTPConn) rejectPASS(outcome, msg string) (bool, constant.Code, string, error) {
+	c.metrics.Login(outcome)
+	c.pendingAccount = nil
+	c.state = StateConnected
+
+	if c.passAttempts >= c.config.Limits.MaxPassAttempts {
+		c.closing = true
+		return false, constant.ServiceNotAvailable, "Too many login attempts, closing control connection.", nil
+	}
+	return false, constant.NotLogin, msg, nil
+}
+
+// 协商TLS，回应 234 后由 handleConnection 完成握手
+func (c *FTPConn) handleAUTH(args []string) (ok bool, code constant.Code, msg string, err error) {
+	if c.tlsConfig == nil {
+		return false, constant.SecurityResourceUnavailable, "TLS is not configured on this server.", nil
+	}
+
+	if len(args) != 1 {
+		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
 	}
 
+	mechanism := strings.ToLower(args[0])
+	if mechanism != "tls" && mechanism != "tls-c" && mechanism != "ssl" {
+		return false, constant.CommandArgsError, "Unsupported security mechanism " + args[0] + ".", nil
+	}
+
+	if _, ok := c.conn.(*tls.Conn); ok {
+		return false, constant.CommandRunFail, "Control connection is already protected by TLS.", nil
+	}
+
+	c.upgradeTLS = true
+	return true, constant.SecurityExchangeOK, "AUTH " + strings.ToUpper(mechanism) + " successful, start negotiation.", nil
+}
+
+// 将控制连接升级为TLS，并检查客户端证书是否映射到账号
+func (c *FTPConn) startTLS() error {
+	c.upgradeTLS = false
+
+	tlsConn := tls.Server(c.conn, c.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.conn = tlsConn
+	c.mu.Unlock()
+	c.reader = bufio.NewScanner(tlsConn)
+	if c.state == StateTLSRequired {
+		c.state = StateConnected
+	}
+
+	// 证书链已在握手中由 ClientCAs 校验
+	if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		c.certAccount = c.users.MatchCertificate(certs[0])
+		if c.certAccount != nil {
+			c.log().Info("Client certificate mapped to account", "cn", certs[0].Subject.CommonName, "account", c.certAccount.Username)
+		}
+	}
+	return nil
+}
+
+// 处理被动链接
+func (c *FTPConn) handlePASV() (ok bool, code constant.Code, msg string, err error) {
 	// 寻找可用端口
-	port, err := findAvailablePort()
+	port, err := findAvailablePort(c.config.PasvPortMin, c.config.PasvPortMax)
 	if err != nil {
 		return false, constant.CannotOpenDataConnection, "Cannot open data connection.", err
 	}
@@ -211,10 +705,14 @@ func (c *FTPConn) handlePASV() (ok bool, code constant.Code, msg string, err err
 	}
 
 	// 开启数据监听
-	c.dataListener, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return false, constant.CannotOpenDataConnection, "Cannot open data connection.", err
 	}
+	listener = c.metrics.TrackPort(listener)
+	c.mu.Lock()
+	c.dataListener = listener
+	c.mu.Unlock()
 
 	// 封装返回信息
 	p1 := port / 256
@@ -224,13 +722,16 @@ func (c *FTPConn) handlePASV() (ok bool, code constant.Code, msg string, err err
 	msg = fmt.Sprintf("Entering Passive Mode (%s,%s,%s,%s,%d,%d)", ipFields[0], ipFields[1], ipFields[2], ipFields[3], p1, p2)
 
 	go func() {
-		conn, err := c.dataListener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
-			log.Println("Error accepting data connection:", err)
+			c.log().Warn("Accept data connection failed", "err", err)
 			c.dataConnChan <- nil
 			return
 		}
-		log.Println("Data connection established with", conn.RemoteAddr())
+		c.log().Debug("Data connection established", "data_remote", conn.RemoteAddr().String())
+		c.mu.Lock()
+		c.transfer = conn
+		c.mu.Unlock()
 		c.dataConnChan <- conn
 	}()
 
@@ -239,10 +740,6 @@ func (c *FTPConn) handlePASV() (ok bool, code constant.Code, msg string, err err
 
 // 改变工作目录
 func (c *FTPConn) handleCWD(args []string) (ok bool, code constant.Code, msg string, err error) {
-	if c.authorisation == constant.NONE {
-		return false, constant.NotLogin, "You have not login.", nil
-	}
-
 	if len(args) != 1 || len(args[0]) == 0 {
 		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
 	}
@@ -250,15 +747,15 @@ func (c *FTPConn) handleCWD(args []string) (ok bool, code constant.Code, msg str
 	newDir := args[0]
 
 	// 路径安全检查
-	absPath, err := c.toAbsPath(newDir)
+	name, err := c.resolve(newDir)
 	if err != nil {
 		return false, constant.PathInvalid, err.Error(), err
 	}
 
 	// 检查是否存在对应目录
-	fileInfo, err := os.Stat(absPath)
+	fileInfo, err := c.home.Stat(name)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return false, constant.PathInvalid, "Directory does not exist.", err
 		}
 		return false, constant.PathInvalid, "Error accessing path.", err
@@ -268,41 +765,19 @@ func (c *FTPConn) handleCWD(args []string) (ok bool, code constant.Code, msg str
 		return false, constant.PathInvalid, "Path is not a directory.", errors.New("path is not a directory")
 	}
 
-	// 基于当前用户根目录，更新工作目录
-	var userRoot string
-	if c.authorisation == constant.ADMIN {
-		userRoot, _ = filepath.Abs(c.rootDir)
-	} else { // USER
-		userRoot, _ = filepath.Abs(filepath.Join(c.rootDir, c.username))
-	}
-
-	newWorkDir, err := filepath.Rel(userRoot, absPath)
-	if err != nil {
-		return false, constant.PathInvalid, "Error resolving relative path.", err
-	}
-
-	c.workDir = "/" + filepath.ToSlash(newWorkDir)
-	if c.workDir == "/." {
-		c.workDir = "/"
-	}
+	// 工作目录为用户根目录下的路径
+	c.workDir = name
 
 	return true, constant.FileCommandRunSuccess, "Directory changed successfully to " + c.workDir, nil
 }
 
 func (c *FTPConn) handlePWD() (ok bool, code constant.Code, msg string, err error) {
-	if c.authorisation == constant.NONE {
-		return false, constant.NotLogin, "You have not login.", nil
-	}
 	return true, constant.FileCommandRunSuccess, "You are now in " + c.workDir, nil
 }
 
 // 查看 filepath 下的文件列表
 // args: [filePath] <limit> <page>
 func (c *FTPConn) handleLIST(args []string) (ok bool, code constant.Code, msg string, err error) {
-	if c.authorisation == constant.NONE {
-		return false, constant.NotLogin, "You have not login.", nil
-	}
-
 	if len(args) != 3 {
 		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
 	}
@@ -326,16 +801,20 @@ func (c *FTPConn) handleLIST(args []string) (ok bool, code constant.Code, msg st
 		return false, constant.CommandArgsError, "Invalid argument <page>.", nil
 	}
 
-	// 获取绝对路径
-	absPath, err := c.toAbsPath(filePath)
+	// 获取用户根目录下的路径
+	name, err := c.resolve(filePath)
 	if err != nil {
 		return false, constant.PathInvalid, err.Error(), err
 	}
 
-	files, err := os.ReadDir(absPath)
+	files, err := c.home.ReadDir(name)
 	if err != nil {
-		return false, constant.PathInvalid, "Cannot open " + absPath, err
+		return false, constant.PathInvalid, "Cannot open " + name, err
 	}
+	// 隐藏服务端内部文件
+	files = slices.DeleteFunc(files, func(f fs.DirEntry) bool {
+		return strings.HasPrefix(f.Name(), ReservedPrefix)
+	})
 
 	// 格式化返回结果
 	start := page * limit
@@ -373,10 +852,6 @@ func (c *FTPConn) handleLIST(args []string) (ok bool, code constant.Code, msg st
 
 // 文件上传至服务端对应的用户目录
 func (c *FTPConn) handleSTOR(args []string) (ok bool, code constant.Code, msg string, err error) {
-	if c.authorisation == constant.NONE {
-		return false, constant.NotLogin, "You have not login.", nil
-	}
-
 	if len(args) != 1 {
 		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
 	}
@@ -390,35 +865,101 @@ func (c *FTPConn) handleSTOR(args []string) (ok bool, code constant.Code, msg st
 		defer c.dataListener.Close()
 	}
 
+	if c.restOffset != 0 {
+		c.restOffset = 0
+		return false, constant.ParameterNotImplemented, "Resuming uploads is not supported.", nil
+	}
+
 	fileName := args[0]
-	absPath, err := c.toAbsPath(fileName)
+	name, err := c.resolve(fileName)
 	if err != nil {
 		return false, constant.PathInvalid, err.Error(), err
 	}
+	absPath := c.absPath(name)
+
+	// 写入期间独占目标文件
+	unlock, err := c.locks.Lock(absPath)
+	if err != nil {
+		return false, constant.FileBusy, "File is busy, please retry later.", err
+	}
+	defer unlock()
 
-	file, err := os.Create(absPath)
+	// 配额检查：新建文件计入文件数，覆盖文件先扣除旧文件大小
+	var replaced int64
+	info, statErr := c.home.Stat(name)
+	if statErr == nil {
+		replaced = info.Size()
+	}
+	quotaRoot, account := c.quotaScope(name)
+	tracker, err := c.quota.Begin(quotaRoot, absPath, account, replaced, statErr != nil)
+	if errors.Is(err, ErrQuotaExceeded) {
+		return false, constant.ExceededStorage, "File count quota exceeded.", err
+	}
 	if err != nil {
+		return false, constant.LocalProcessingError, "Cannot compute storage usage.", err
+	}
+
+	// 先写入同目录的临时文件，数据完整接收后再重命名覆盖目标文件
+	tempPath, err := uploadTempPath(name)
+	if err != nil {
+		tracker.Cancel()
+		return false, constant.LocalProcessingError, "Cannot create temporary file.", err
+	}
+	file, err := c.home.Create(tempPath)
+	if err != nil {
+		tracker.Cancel()
 		return false, constant.PathInvalid, "Cannot create file.", err
 	}
-	defer file.Close()
 
 	c.respond(constant.DataConnectionOpen, "Ok to send data.")
+	transfer := c.startTransfer(absPath, true)
+	defer c.endTransfer()
 
-	n, err := io.Copy(file, c.dataConn)
+	// 部分驱动在关闭时才提交数据，关闭失败同样视为传输失败
+	n, err := io.Copy(tracker.Writer(file), countingReader{c.dataConn, transfer})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	// 覆盖已有文件前保存历史版本
+	if err == nil && statErr == nil {
+		err = c.versions.Save(absPath)
+	}
+	if err == nil {
+		err = c.home.Rename(tempPath, name)
+	}
+	c.logTransfer(transfer.started, absPath, n, true, err == nil)
 	if err != nil {
+		// 失败时删除临时文件，原文件保持不变
+		if removeErr := c.home.Remove(tempPath); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			c.log().Warn("Remove temporary file failed", "err", removeErr)
+		}
+		tracker.Cancel()
+		if errors.Is(err, ErrQuotaExceeded) {
+			return false, constant.ExceededStorage, "Storage quota exceeded, upload aborted.", err
+		}
 		return false, constant.TransferAborted, "Failed to write to file.", err
 	}
-	log.Printf("%d bytes received", n)
+	c.log().Info("File received", "path", absPath, "bytes", n)
 
 	return true, constant.ClosingDataConnection, "File received ok.", nil
 }
 
-// 文件下载
-func (c *FTPConn) handleRETR(args []string) (bool, constant.Code, string, error) {
-	if c.authorisation == constant.NONE {
-		return false, constant.NotLogin, "You have not login.", nil
+// 设置下一次下载的起始位置
+// args: [offset]
+func (c *FTPConn) handleREST(args []string) (ok bool, code constant.Code, msg string, err error) {
+	if len(args) != 1 {
+		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
 	}
+	offset, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || offset < 0 {
+		return false, constant.CommandArgsError, "Invalid restart position.", nil
+	}
+	c.restOffset = offset
+	return true, constant.FileActionPending, fmt.Sprintf("Restarting at %d. Send RETR to resume transfer.", offset), nil
+}
 
+// 文件下载
+func (c *FTPConn) handleRETR(args []string) (bool, constant.Code, string, error) {
 	if len(args) != 1 {
 		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
 	}
@@ -433,85 +974,229 @@ func (c *FTPConn) handleRETR(args []string) (bool, constant.Code, string, error)
 	}
 
 	fileName := args[0]
-	absPath, err := c.toAbsPath(fileName)
+	name, err := c.resolve(fileName)
 	if err != nil {
 		return false, constant.PathInvalid, err.Error(), err
 	}
 
-	file, err := os.Open(absPath)
+	unlock, err := c.locks.RLock(c.absPath(name))
+	if err != nil {
+		return false, constant.FileBusy, "File is busy, please retry later.", err
+	}
+	defer unlock()
+
+	file, err := c.home.Open(name)
 	// 文件不存在
 	if err != nil {
 		return false, constant.CommandRunFail, "File does not exist.", err
 	}
 	defer file.Close()
 
+	// 从 REST 指定的位置开始发送
+	offset := c.restOffset
+	c.restOffset = 0
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return false, constant.LocalProcessingError, "Cannot seek to restart position.", err
+		}
+	}
+
 	c.respond(constant.DataConnectionOpen, "Ok to send data.")
+	transfer := c.startTransfer(c.absPath(name), false)
+	defer c.endTransfer()
 
-	n, err := io.Copy(c.dataConn, file)
+	n, err := io.Copy(countingWriter{c.dataConn, transfer}, file)
+	c.logTransfer(transfer.started, transfer.path, n, false, err == nil)
 	if err != nil {
 		return false, constant.TransferAborted, "Failed to read from file.", err
 	}
-	log.Printf("%d bytes sent", n)
+	c.log().Info("File sent", "path", c.absPath(name), "bytes", n)
 
 	return true, constant.ClosingDataConnection, "File sent ok.", nil
 }
 
-// toAbsPath 此方法将客户端提供的 [filePath] 转换为安全的服务端绝对路径，确保处于合法操作范围内
-func (c *FTPConn) toAbsPath(path string) (string, error) {
-	var userRoot string
-	var err error
+// 删除文件，启用回收站时移入回收站
+func (c *FTPConn) handleDELE(args []string) (ok bool, code constant.Code, msg string, err error) {
+	return c.remove(args, false)
+}
+
+// 删除目录及其中的全部内容，启用回收站时移入回收站
+func (c *FTPConn) handleRMD(args []string) (ok bool, code constant.Code, msg string, err error) {
+	return c.remove(args, true)
+}
+
+func (c *FTPConn) remove(args []string, dir bool) (ok bool, code constant.Code, msg string, err error) {
+	if len(args) != 1 || len(args[0]) == 0 {
+		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
+	}
+
+	name, err := c.resolve(args[0])
+	if err != nil {
+		return false, constant.PathInvalid, err.Error(), err
+	}
+	if name == "/" {
+		return false, constant.PathInvalid, "Cannot remove the root directory.", errors.New("cannot remove root directory")
+	}
+	if err := c.checkWritable(name); err != nil {
+		return false, constant.PathInvalid, err.Error(), err
+	}
+	absPath := c.absPath(name)
+
+	unlock, err := c.locks.Lock(absPath)
+	if err != nil {
+		return false, constant.FileBusy, "File is busy, please retry later.", err
+	}
+	defer unlock()
+
+	info, err := c.home.Stat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, constant.PathInvalid, "File does not exist.", err
+		}
+		return false, constant.PathInvalid, "Error accessing path.", err
+	}
+	if dir && !info.IsDir() {
+		return false, constant.PathInvalid, "Path is not a directory.", errors.New("path is not a directory")
+	}
+	if !dir && info.IsDir() {
+		return false, constant.PathInvalid, "Path is a directory, use RMD.", errors.New("path is a directory")
+	}
+
+	bytes, files, err := diskUsage(c.home, name)
+	if err != nil {
+		return false, constant.LocalProcessingError, "Cannot compute storage usage.", err
+	}
+
+	if c.trash.Enabled() {
+		err = c.trash.Put(c.username, absPath, name)
+	} else {
+		err = vfs.RemoveAll(c.home, name)
+	}
+	if err != nil {
+		return false, constant.LocalProcessingError, "Failed to delete " + args[0] + ".", err
+	}
+	c.quota.Update(absPath, -bytes, -files)
+	c.log().Info("Deleted", "path", absPath)
+
+	// 当前工作目录被删除时回到根目录
+	if dir && (c.workDir == name || strings.HasPrefix(c.workDir, name+"/")) {
+		c.workDir = "/"
+	}
+
+	if c.trash.Enabled() {
+		return true, constant.FileCommandRunSuccess, "Moved " + name + " to trash.", nil
+	}
+	return true, constant.FileCommandRunSuccess, "Deleted " + name + ".", nil
+}
+
+// resolve 此方法将客户端提供的 [filePath] 转换为用户根目录下的路径，并确保 c.home 已打开
+func (c *FTPConn) resolve(filePath string) (string, error) {
+	if err := c.openHome(); err != nil {
+		return "", err
+	}
+
+	var targetPath string
+	// 若新路径以 “/” 开头，则视作从根目录开始
+	// 若不是，则视作从当前工作目录开始
+	// 以 “/” 为基准的 path.Join 同时处理 “..” 和 “.”，结果不会越出用户根目录；
+	// 符号链接由 c.home 在访问时限制
+	if strings.HasPrefix(filePath, "/") {
+		targetPath = path.Join("/", filePath)
+	} else {
+		targetPath = path.Join("/", c.workDir, filePath)
+	}
+
+	if isReservedPath(targetPath) {
+		return "", errors.New("access denied: reserved file name")
+	}
+	return targetPath, nil
+}
+
+// 用户路径在存储驱动中的绝对路径，用于配额、历史版本与回收站
+func (c *FTPConn) absPath(name string) string {
+	if mount, rest := c.mountFor(name); mount != nil {
+		return path.Join(mount.Source, rest)
+	}
+	return path.Join(c.root, name)
+}
+
+// 打开以当前用户根目录为根的驱动，并叠加账号的挂载点
+func (c *FTPConn) openHome() error {
+	if c.home != nil {
+		return nil
+	}
+	userRoot, err := c.userRoot()
+	if err != nil {
+		return err
+	}
+	home, err := vfs.Sub(c.fs, userRoot)
+	if err != nil {
+		return errors.New("cannot open user directory")
+	}
+	c.root = userRoot
+	c.home, c.mounts = mountAll(c.log(), c.fs, home, c.account.Mounts)
+	return nil
+}
 
+// 当前用户在存储驱动中的根目录
+func (c *FTPConn) userRoot() (string, error) {
 	// 根据职权判断
 	switch c.authorisation {
 	case constant.ADMIN:
-		userRoot, err = filepath.Abs(c.rootDir)
-		if err != nil {
-			return "", errors.New("cannot resolve server root directory")
-		}
+		return "/", nil
 	case constant.USER:
-		userRoot = filepath.Join(c.rootDir, c.username)
+		userRoot := path.Join("/", c.homeDir())
 		// 确保用户的根目录存在，如不存在则创建
-		if _, err := os.Stat(userRoot); os.IsNotExist(err) {
-			if err := os.MkdirAll(userRoot, 0755); err != nil {
-				return "", errors.New("cannot create user directory")
-			}
-		}
-		userRoot, err = filepath.Abs(userRoot)
-		if err != nil {
-			return "", errors.New("cannot resolve user root directory")
+		if err := vfs.MkdirAll(c.fs, userRoot); err != nil {
+			return "", errors.New("cannot create user directory")
 		}
+		return userRoot, nil
 	default:
 		return "", errors.New("user not logged in")
 	}
+}
 
-	var targetPath string
-	// 若新路径以 “/” 开头，则视作从根目录开始
-	// 若不是，则视作从当前工作目录开始
-	if strings.HasPrefix(path, "/") {
-		targetPath = filepath.Join(userRoot, path)
-	} else {
-		// Note: c.workDir is relative to the user's root.
-		currentPath := filepath.Join(userRoot, c.workDir)
-		targetPath = filepath.Join(currentPath, path)
+// 加载TLS配置，未提供证书时返回 nil；提供客户端CA时校验客户端证书
+func loadTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
 	}
 
-	// 处理 “..” 和 “.”
-	cleanPath, err := filepath.Abs(targetPath)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
-		return "", errors.New("error resolving path")
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
 	}
 
-	// 安全监测：确保最终路径处于合法范围内
-	if !strings.HasPrefix(cleanPath, userRoot) {
-		return "", errors.New("access denied: attempt to access outside of designated directory")
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
 	}
+	return config, nil
+}
 
-	return cleanPath, nil
+// 普通用户的主目录（相对于根目录），默认为 /<username>
+func (c *FTPConn) homeDir() string {
+	if c.account != nil {
+		return c.account.HomeDir()
+	}
+	return c.username
 }
 
-// 从 PasvPortMin 到 PasvPortMax 中选取一个可用的端口号并返回
-func findAvailablePort() (port int, err error) {
-	for port := PasvPortMin; port <= PasvPortMax; port++ {
+// 从 minPort 到 maxPort 中选取一个可用的端口号并返回
+func findAvailablePort(minPort, maxPort int) (port int, err error) {
+	for port := minPort; port <= maxPort; port++ {
 		// 依次遍历，开启监听不报错即可用
 		addr := fmt.Sprintf(":%d", port)
 		l, err := net.Listen("tcp", addr)
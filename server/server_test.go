@@ -0,0 +1,412 @@
+package main
+
+import (
+	"GoFTP/constant"
+	"GoFTP/vfs"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试用账号的口令
+const testPassword = "Secret-123"
+
+// PBKDF2 较慢，各测试共用同一个口令哈希
+var testPasswordHash = sync.OnceValue(func() string {
+	hash, err := hashPassword(testPassword)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// 测试服务端：以内存驱动为存储，会话经 net.Pipe 连接，不读写磁盘
+type testServer struct {
+	fs     *vfs.MemoryFS
+	users  *UserStore
+	config *Config
+	guard  *LoginGuard
+	locks  *LockManager
+	quota  *QuotaManager
+}
+
+func newTestServer(t *testing.T, accounts ...*Account) *testServer {
+	t.Helper()
+	for _, account := range accounts {
+		account.Password = testPasswordHash()
+	}
+	cfg := DefaultConfig()
+	cfg.PasvPortMin, cfg.PasvPortMax = 40000, 40100
+	cfg.PublicIP = "127.0.0.1"
+
+	fileSystem := vfs.NewMemoryFS()
+	return &testServer{
+		fs:     fileSystem,
+		users:  &UserStore{Users: accounts},
+		config: &cfg,
+		guard:  NewLoginGuard(),
+		locks:  NewLockManager(0),
+		quota:  NewQuotaManager(fileSystem),
+	}
+}
+
+// 建立一个会话，返回客户端一侧
+func (s *testServer) connect(t *testing.T) *testClient {
+	t.Helper()
+	server, client := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	limiter := NewSessionLimiter()
+	c := &FTPConn{
+		id:             newSessionID(),
+		connected:      time.Now(),
+		status:         sessionStatus{dir: "/"},
+		ctx:            ctx,
+		conn:           server,
+		authorisation:  constant.NONE,
+		state:          StateConnected,
+		fs:             s.fs,
+		workDir:        "/",
+		publicIp:       s.config.PublicIP,
+		dataConnChan:   make(chan net.Conn, 1),
+		guard:          s.guard,
+		users:          s.users,
+		auth:           s.users,
+		passwordPolicy: &s.config.Password,
+		config:         s.config,
+		logger:         slog.New(slog.DiscardHandler),
+		metrics:        NewMetrics(limiter, func() int { return 0 }),
+		quota:          s.quota,
+		versions:       NewVersioner(s.fs, s.config.Versioning),
+		trash:          NewTrash(s.fs, time.Duration(s.config.TrashRetention)),
+		locks:          s.locks,
+		limiter:        limiter,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.handleConnection()
+	}()
+	t.Cleanup(func() {
+		cancel()
+		client.Close()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("session did not exit after the client disconnected")
+		}
+	})
+
+	tc := &testClient{t: t, conn: client, reader: bufio.NewReader(client)}
+	client.SetDeadline(time.Now().Add(10 * time.Second))
+	tc.expect(constant.ServiceReady)
+	return tc
+}
+
+// 以账号登录的会话
+func (s *testServer) login(t *testing.T, username string) *testClient {
+	t.Helper()
+	c := s.connect(t)
+	c.cmd(constant.NeedUsername, "login")
+	c.cmd(constant.NeedPassword, "username "+username)
+	c.cmd(constant.CommandRunSuccess, "password "+testPassword)
+	return c
+}
+
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// 读取一行回应，返回回应码与消息
+func (c *testClient) read() (constant.Code, string) {
+	c.t.Helper()
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read response: %v", err)
+	}
+	code, msg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " | ")
+	return constant.Code(code), msg
+}
+
+func (c *testClient) expect(want constant.Code) string {
+	c.t.Helper()
+	code, msg := c.read()
+	if code != want {
+		c.t.Fatalf("response %s %q, want %s", code, msg, want)
+	}
+	return msg
+}
+
+func (c *testClient) send(line string) {
+	c.t.Helper()
+	if _, err := fmt.Fprint(c.conn, line+"\r\n"); err != nil {
+		c.t.Fatalf("send %q: %v", line, err)
+	}
+}
+
+// 发送指令并校验回应码，返回回应消息
+func (c *testClient) cmd(want constant.Code, line string) string {
+	c.t.Helper()
+	c.send(line)
+	return c.expect(want)
+}
+
+var pasvAddr = regexp.MustCompile(`\((\d+),(\d+),(\d+),(\d+),(\d+),(\d+)\)`)
+
+// 进入被动模式并建立数据连接
+func (c *testClient) pasv() net.Conn {
+	c.t.Helper()
+	m := pasvAddr.FindStringSubmatch(c.cmd(constant.EnteringPassiveMode, "passive"))
+	if m == nil {
+		c.t.Fatal("PASV response without address")
+	}
+	p1, _ := strconv.Atoi(m[5])
+	p2, _ := strconv.Atoi(m[6])
+	conn, err := net.Dial("tcp", fmt.Sprintf("%s.%s.%s.%s:%d", m[1], m[2], m[3], m[4], p1*256+p2))
+	if err != nil {
+		c.t.Fatalf("dial data connection: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return conn
+}
+
+// 上传文件，返回最终回应码
+func (c *testClient) stor(name string, data []byte) constant.Code {
+	c.t.Helper()
+	conn := c.pasv()
+	defer conn.Close()
+	c.send("stor " + name)
+	code, _ := c.read()
+	if code != constant.DataConnectionOpen {
+		return code
+	}
+	conn.Write(data)
+	conn.Close()
+	code, _ = c.read()
+	return code
+}
+
+// 下载文件或目录列表，失败时返回回应码
+func (c *testClient) retrieve(line string) ([]byte, constant.Code) {
+	c.t.Helper()
+	conn := c.pasv()
+	defer conn.Close()
+	c.send(line)
+	code, _ := c.read()
+	if code != constant.DataConnectionOpen {
+		return nil, code
+	}
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		c.t.Fatalf("read data connection: %v", err)
+	}
+	code, _ = c.read()
+	return data, code
+}
+
+func TestLoginSequence(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser})
+	c := s.connect(t)
+
+	c.cmd(constant.NotLogin, "pwd")
+	c.cmd(constant.BadSequence, "username alice")
+	c.cmd(constant.NeedUsername, "login")
+	c.cmd(constant.NeedPassword, "username alice")
+	c.cmd(constant.NotLogin, "password wrong")
+
+	// 失败后需从 login 重新开始
+	c.cmd(constant.BadSequence, "password "+testPassword)
+	c.cmd(constant.NeedUsername, "login")
+	c.cmd(constant.NeedPassword, "username alice")
+	c.cmd(constant.CommandRunSuccess, "password "+testPassword)
+	c.cmd(constant.BadSequence, "login")
+	if msg := c.cmd(constant.FileCommandRunSuccess, "pwd"); !strings.HasSuffix(msg, " /") {
+		t.Errorf("pwd = %q, want /", msg)
+	}
+}
+
+// 启用两步验证的账号在密码后需提交验证码，验证码也可直接附加在密码后
+func TestLoginWithVerifyCode(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser, TOTPSecret: rfcSecret})
+	key, _ := totpEncoding.DecodeString(rfcSecret)
+	step := time.Now().Unix() / totpPeriod
+
+	c := s.connect(t)
+	c.cmd(constant.NeedUsername, "login")
+	c.cmd(constant.NeedPassword, "username alice")
+	c.cmd(constant.NeedVerifyCode, "password "+testPassword)
+	c.cmd(constant.CommandRunSuccess, "acct "+totpCode(key, step))
+
+	c = s.connect(t)
+	c.cmd(constant.NeedUsername, "login")
+	c.cmd(constant.NeedPassword, "username alice")
+	c.cmd(constant.CommandRunSuccess, "password "+testPassword+totpCode(key, step+1))
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser})
+	c := s.login(t, "alice")
+
+	content := []byte(strings.Repeat("hello world\n", 1000))
+	if code := c.stor("notes.txt", content); code != constant.ClosingDataConnection {
+		t.Fatalf("stor = %s", code)
+	}
+
+	// 普通用户的文件位于其主目录下
+	stored, err := vfs.ReadFile(s.fs, "/alice/notes.txt")
+	if err != nil || string(stored) != string(content) {
+		t.Fatalf("stored file = %d bytes, %v; want %d bytes", len(stored), err, len(content))
+	}
+
+	data, code := c.retrieve("retr notes.txt")
+	if code != constant.ClosingDataConnection || string(data) != string(content) {
+		t.Errorf("retr = %d bytes, %s; want %d bytes, 226", len(data), code, len(content))
+	}
+}
+
+func TestRestartDownload(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser})
+	vfs.MkdirAll(s.fs, "/alice")
+	vfs.WriteFile(s.fs, "/alice/digits.txt", []byte("0123456789"))
+	c := s.login(t, "alice")
+
+	c.cmd(constant.FileActionPending, "rest 4")
+	data, code := c.retrieve("retr digits.txt")
+	if code != constant.ClosingDataConnection || string(data) != "456789" {
+		t.Errorf("retr after rest = %q, %s; want %q", data, code, "456789")
+	}
+
+	// 偏移只对下一次下载生效
+	data, _ = c.retrieve("retr digits.txt")
+	if string(data) != "0123456789" {
+		t.Errorf("second retr = %q, want whole file", data)
+	}
+}
+
+func TestRestartUploadRejected(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser})
+	c := s.login(t, "alice")
+
+	c.cmd(constant.FileActionPending, "rest 10")
+	if code := c.stor("a.txt", []byte("abc")); code != constant.ParameterNotImplemented {
+		t.Fatalf("stor after rest = %s, want 504", code)
+	}
+	// 被拒绝的上传不能占用数据连接，之后的传输正常进行
+	if code := c.stor("a.txt", []byte("abc")); code != constant.ClosingDataConnection {
+		t.Errorf("stor = %s, want 226", code)
+	}
+}
+
+func TestListHidesReservedFiles(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser})
+	vfs.MkdirAll(s.fs, "/alice/docs")
+	vfs.WriteFile(s.fs, "/alice/b.txt", nil)
+	vfs.WriteFile(s.fs, "/alice/"+UploadTempPrefix+"0011", nil)
+	c := s.login(t, "alice")
+
+	data, code := c.retrieve("list / 10 0")
+	if code != constant.ClosingDataConnection {
+		t.Fatalf("list = %s", code)
+	}
+	if want := "\n 1. b.txt\n 2. docs\n"; string(data) != want {
+		t.Errorf("list = %q, want %q", data, want)
+	}
+	if data, code := c.retrieve("retr " + UploadTempPrefix + "0011"); code != constant.PathInvalid {
+		t.Errorf("retr reserved file = %q, %s; want 550", data, code)
+	}
+}
+
+func TestChangeDirectory(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser})
+	vfs.MkdirAll(s.fs, "/alice/docs")
+	vfs.WriteFile(s.fs, "/alice/docs/a.txt", []byte("a"))
+	c := s.login(t, "alice")
+
+	c.cmd(constant.FileCommandRunSuccess, "cwd docs")
+	if msg := c.cmd(constant.FileCommandRunSuccess, "pwd"); !strings.HasSuffix(msg, " /docs") {
+		t.Errorf("pwd = %q, want /docs", msg)
+	}
+	if data, _ := c.retrieve("retr a.txt"); string(data) != "a" {
+		t.Errorf("retr relative to cwd = %q", data)
+	}
+	c.cmd(constant.PathInvalid, "cwd a.txt")
+	c.cmd(constant.PathInvalid, "cwd missing")
+}
+
+func TestUserConfinedToHome(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser}, &Account{Username: "bob", Role: RoleUser})
+	vfs.MkdirAll(s.fs, "/bob")
+	vfs.WriteFile(s.fs, "/bob/secret.txt", []byte("bob's"))
+	c := s.login(t, "alice")
+
+	for _, name := range []string{"../bob/secret.txt", "/../bob/secret.txt", "/bob/secret.txt"} {
+		if data, code := c.retrieve("retr " + name); data != nil || code == constant.ClosingDataConnection {
+			t.Errorf("retr %s = %q, %s; want failure", name, data, code)
+		}
+	}
+	if code := c.stor("../bob/secret.txt", []byte("overwritten")); code == constant.ClosingDataConnection {
+		t.Errorf("stor outside home succeeded")
+	}
+	if data, _ := vfs.ReadFile(s.fs, "/bob/secret.txt"); string(data) != "bob's" {
+		t.Errorf("bob's file = %q", data)
+	}
+}
+
+func TestDeleteMovesToTrash(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser})
+	vfs.MkdirAll(s.fs, "/alice")
+	vfs.WriteFile(s.fs, "/alice/old.txt", []byte("old"))
+	c := s.login(t, "alice")
+
+	c.cmd(constant.FileCommandRunSuccess, "dele old.txt")
+	if _, err := s.fs.Stat("/alice/old.txt"); err == nil {
+		t.Error("file still exists after dele")
+	}
+	if msg := c.cmd(constant.CommandRunSuccess, "site trash"); !strings.Contains(msg, "/old.txt") {
+		t.Errorf("site trash = %q, want old.txt listed", msg)
+	}
+	c.cmd(constant.PathInvalid, "dele old.txt")
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser, Quota: 100, QuotaFiles: 2})
+	c := s.login(t, "alice")
+
+	if code := c.stor("big.bin", make([]byte, 200)); code != constant.ExceededStorage {
+		t.Errorf("stor over byte quota = %s, want 552", code)
+	}
+	if _, err := s.fs.Stat("/alice/big.bin"); err == nil {
+		t.Error("file kept after quota was exceeded")
+	}
+
+	c.stor("a.txt", []byte("a"))
+	c.stor("b.txt", []byte("b"))
+	if code := c.stor("c.txt", []byte("c")); code != constant.ExceededStorage {
+		t.Errorf("stor over file quota = %s, want 552", code)
+	}
+}
+
+func TestFileLockBlocksConcurrentWriter(t *testing.T) {
+	s := newTestServer(t, &Account{Username: "alice", Role: RoleUser})
+	c := s.login(t, "alice")
+
+	unlock, err := s.locks.Lock("/alice/busy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if code := c.stor("busy.txt", []byte("x")); code != constant.FileBusy {
+		t.Errorf("stor locked file = %s, want 450", code)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"GoFTP/constant"
+	"slices"
+)
+
+// SessionState 会话登录状态
+type SessionState int
+
+const (
+	StateTLSRequired   SessionState = iota // 要求先通过 AUTH TLS 加密控制连接
+	StateConnected                         // 已连接，等待 login
+	StateNeedUsername                      // 已发送 login，等待用户名
+	StateNeedPassword                      // 已给出用户名，等待密码
+	StateNeedCode                          // 密码正确，等待两步验证码
+	StateAuthenticated                     // 已登录
+)
+
+// 登录流程中使用的指令
+var loginCommands = []string{constant.AUTH, constant.LOGIN, constant.USR, constant.PASS, constant.ACCT}
+
+// 登录前各状态允许的指令；登录后允许除登录流程外的全部指令
+var stateCommands = map[SessionState][]string{
+	StateTLSRequired:  {constant.AUTH},
+	StateConnected:    {constant.AUTH, constant.LOGIN},
+	StateNeedUsername: {constant.USR},
+	StateNeedPassword: {constant.PASS},
+	StateNeedCode:     {constant.ACCT},
+}
+
+// 当前状态下是否允许该指令
+func (s SessionState) allows(command string) bool {
+	if s == StateAuthenticated {
+		return !slices.Contains(loginCommands, command)
+	}
+	return slices.Contains(stateCommands[s], command)
+}
+
+// 当前状态下期望的下一步操作
+func (s SessionState) expect() string {
+	switch s {
+	case StateTLSRequired:
+		return "TLS is required, use AUTH TLS first."
+	case StateConnected:
+		return "use login first."
+	case StateNeedUsername:
+		return "send username first."
+	case StateNeedPassword:
+		return "send password first."
+	case StateNeedCode:
+		return "send verification code first."
+	default:
+		return "you have already login."
+	}
+}
+
+// 按会话状态检查指令是否合法：未登录时的非登录指令回应 530，其余顺序错误回应 503
+func (c *FTPConn) checkSequence(command string) (bool, constant.Code, string) {
+	if c.state.allows(command) {
+		return true, "", ""
+	}
+
+	if c.state != StateAuthenticated && !slices.Contains(loginCommands, command) {
+		return false, constant.NotLogin, "You have not login."
+	}
+	if c.state == StateAuthenticated {
+		return false, constant.BadSequence, "You have already login, username: " + c.username
+	}
+	return false, constant.BadSequence, "Bad sequence of commands, " + c.state.expect()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 供管理接口读取的会话状态，由 FTPConn.mu 保护；会话协程在指令前后更新
+type sessionStatus struct {
+	user     string
+	dir      string
+	command  string          // 正在执行的指令
+	transfer *transferStatus // 正在进行的传输
+}
+
+// 正在进行的传输，字节数随数据收发实时增加
+type transferStatus struct {
+	path     string
+	incoming bool
+	started  time.Time
+	bytes    atomic.Int64
+	total    *atomic.Int64 // 会话累计的同方向字节数
+}
+
+func (t *transferStatus) add(n int) {
+	t.bytes.Add(int64(n))
+	t.total.Add(int64(n))
+}
+
+type countingReader struct {
+	io.Reader
+	transfer *transferStatus
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.transfer.add(n)
+	return n, err
+}
+
+type countingWriter struct {
+	io.Writer
+	transfer *transferStatus
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.transfer.add(n)
+	return n, err
+}
+
+// 开始一次传输，name 为存储驱动中的绝对路径
+func (c *FTPConn) startTransfer(name string, incoming bool) *transferStatus {
+	t := &transferStatus{path: name, incoming: incoming, started: time.Now(), total: &c.bytesOut}
+	if incoming {
+		t.total = &c.bytesIn
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.transfer = t
+	return t
+}
+
+// 传输结束
+func (c *FTPConn) endTransfer() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.transfer = nil
+}
+
+// SessionInfo 会话概况
+type SessionInfo struct {
+	ID        string        `json:"id"`
+	User      string        `json:"user,omitempty"`
+	IP        string        `json:"ip"`
+	Dir       string        `json:"cwd"`
+	Command   string        `json:"command,omitempty"`
+	Connected time.Time     `json:"connected"`
+	Duration  Duration      `json:"duration"`
+	BytesIn   int64         `json:"bytes_in"`
+	BytesOut  int64         `json:"bytes_out"`
+	Transfer  *TransferInfo `json:"transfer,omitempty"`
+}
+
+// TransferInfo 正在进行的传输
+type TransferInfo struct {
+	Path      string   `json:"path"`
+	Direction string   `json:"direction"` // in 上传，out 下载
+	Bytes     int64    `json:"bytes"`
+	Duration  Duration `json:"duration"`
+}
+
+// Info 会话当前的概况，可在其他协程中调用
+func (c *FTPConn) Info() SessionInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	info := SessionInfo{
+		ID:        c.id,
+		User:      c.status.user,
+		IP:        remoteIP(c.conn),
+		Dir:       c.status.dir,
+		Command:   c.status.command,
+		Connected: c.connected,
+		Duration:  Duration(now.Sub(c.connected).Round(time.Second)),
+		BytesIn:   c.bytesIn.Load(),
+		BytesOut:  c.bytesOut.Load(),
+	}
+	if t := c.status.transfer; t != nil {
+		info.Transfer = &TransferInfo{
+			Path:      t.path,
+			Direction: "out",
+			Bytes:     t.bytes.Load(),
+			Duration:  Duration(now.Sub(t.started).Round(time.Millisecond)),
+		}
+		if t.incoming {
+			info.Transfer.Direction = "in"
+		}
+	}
+	return info
+}
+
+// 断开会话：回应 421 后强制关闭控制连接与数据连接
+func (c *FTPConn) kick() {
+	c.hangUp("Disconnected by administrator.")
+}
+
+// SessionRegistry 在线会话表
+type SessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*FTPConn
+}
+
+func NewSessionRegistry() *SessionRegistry {
+	return &SessionRegistry{sessions: make(map[string]*FTPConn)}
+}
+
+// 会话ID已被在线会话占用
+var ErrSessionIDInUse = errors.New("session ID already in use")
+
+// Add 登记会话，返回会话结束时调用的注销函数；ID 重复时不覆盖已登记的会话
+func (r *SessionRegistry) Add(c *FTPConn) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[c.id]; ok {
+		return nil, ErrSessionIDInUse
+	}
+	r.sessions[c.id] = c
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.sessions, c.id)
+	}, nil
+}
+
+// Get 按ID查找会话
+func (r *SessionRegistry) Get(id string) *FTPConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sessions[id]
+}
+
+// List 全部在线会话
+func (r *SessionRegistry) List() []*FTPConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := make([]*FTPConn, 0, len(r.sessions))
+	for _, c := range r.sessions {
+		sessions = append(sessions, c)
+	}
+	return sessions
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"GoFTP/constant"
+	"GoFTP/vfs"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 站点扩展指令
+// args: [subcommand] <args...>
+func (c *FTPConn) handleSITE(args []string) (ok bool, code constant.Code, msg string, err error) {
+	if len(args) == 0 {
+		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
+	}
+
+	switch strings.ToLower(args[0]) {
+	case constant.PASSWD: // 修改密码
+		return c.handleSitePASSWD(args[1:])
+	case constant.QUOTA: // 查看存储配额
+		return c.handleSiteQUOTA()
+	case constant.VERSIONS: // 查看文件历史版本
+		return c.handleSiteVERSIONS(args[1:])
+	case constant.RESTORE: // 恢复文件历史版本
+		return c.handleSiteRESTORE(args[1:])
+	case constant.TRASH: // 回收站
+		return c.handleSiteTRASH(args[1:])
+	case constant.RELOAD: // 重新加载配置
+		return c.handleSiteRELOAD()
+	default:
+		return false, constant.ParameterNotImplemented, "Unknown SITE command " + args[0] + ".", nil
+	}
+}
+
+// 修改当前账号的密码
+// args: [oldPassword] [newPassword]
+func (c *FTPConn) handleSitePASSWD(args []string) (ok bool, code constant.Code, msg string, err error) {
+	if len(args) != 2 || len(args[0]) == 0 || len(args[1]) == 0 {
+		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
+	}
+
+	changer, ok := c.auth.(PasswordChanger)
+	if !ok {
+		return false, constant.CommandNotImplemented, "Password change is not supported by the authentication backend.", nil
+	}
+
+	oldPassword, newPassword := args[0], args[1]
+
+	// 校验旧密码，失败同样计入防爆破计数
+	ip := remoteIP(c.conn)
+	if locked, until := c.guard.Locked(c.username, ip); locked {
+		return false, constant.NotLogin, "Too many failed attempts, locked until " + until.Format(time.DateTime), nil
+	}
+	if _, err := c.auth.Authenticate(c.username, oldPassword, ip); err != nil {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return false, constant.LocalProcessingError, "Authentication service unavailable, please retry later.", err
+		}
+		time.Sleep(c.guard.Fail(c.username, ip))
+		return false, constant.NotLogin, "Old password is incorrect.", nil
+	}
+
+	if oldPassword == newPassword {
+		return false, constant.CommandArgsError, "New password must differ from the old one.", nil
+	}
+	if err := c.passwordPolicy.Validate(c.username, newPassword); err != nil {
+		return false, constant.CommandArgsError, "Password rejected: " + err.Error() + ".", nil
+	}
+
+	if err := changer.ChangePassword(c.username, newPassword); err != nil {
+		return false, constant.LocalProcessingError, "Failed to change password.", err
+	}
+	c.log().Info("Password changed")
+
+	return true, constant.CommandRunSuccess, "Password changed.", nil
+}
+
+// 查看当前账号的存储用量与配额
+func (c *FTPConn) handleSiteQUOTA() (ok bool, code constant.Code, msg string, err error) {
+	userRoot, err := c.userRoot()
+	if err != nil {
+		return false, constant.PathInvalid, err.Error(), err
+	}
+
+	bytes, files, err := c.quota.Usage(userRoot)
+	if err != nil {
+		return false, constant.LocalProcessingError, "Cannot compute storage usage.", err
+	}
+
+	msg = fmt.Sprintf("Used %d of %s bytes, %d of %s files.", bytes, quotaLimit(c.account.Quota), files, quotaLimit(c.account.QuotaFiles))
+	return true, constant.CommandRunSuccess, msg, nil
+}
+
+// 配额上限的显示文本
+func quotaLimit(limit int64) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// 列出文件的历史版本
+// args: [filePath]
+func (c *FTPConn) handleSiteVERSIONS(args []string) (ok bool, code constant.Code, msg string, err error) {
+	if len(args) != 1 {
+		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
+	}
+
+	name, err := c.resolve(args[0])
+	if err != nil {
+		return false, constant.PathInvalid, err.Error(), err
+	}
+
+	versions, err := c.versions.List(c.absPath(name))
+	if err != nil {
+		return false, constant.LocalProcessingError, "Cannot list versions.", err
+	}
+	if len(versions) == 0 {
+		return true, constant.CommandRunSuccess, "No previous versions of " + args[0] + ".", nil
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d version(s) of %s:", len(versions), args[0])
+	for _, v := range versions {
+		fmt.Fprintf(&builder, " %s (%d bytes);", v.Name(), v.Size())
+	}
+	return true, constant.CommandRunSuccess, strings.TrimSuffix(builder.String(), ";"), nil
+}
+
+// 用历史版本覆盖文件，覆盖前的内容同样会保存为新版本
+// args: [filePath] [version]
+func (c *FTPConn) handleSiteRESTORE(args []string) (ok bool, code constant.Code, msg string, err error) {
+	if len(args) != 2 {
+		return false, constant.CommandArgsError, "Invalid number of arguments.", nil
+	}
+
+	name, err := c.resolve(args[0])
+	if err != nil {
+		return false, constant.PathInvalid, err.Error(), err
+	}
+	absPath := c.absPath(name)
+
+	unlock, err := c.locks.Lock(absPath)
+	if err != nil {
+		return false, constant.FileBusy, "File is busy, please retry later.", err
+	}
+	defer unlock()
+
+	version, err := c.versions.Open(absPath, args[1])
+	if err != nil {
+		return false, constant.PathInvalid, "Version " + args[1] + " does not exist.", err
+	}
+	defer version.Close()
+
+	var replaced int64
+	info, statErr := c.home.Stat(name)
+	if statErr == nil {
+		if info.IsDir() {
+			return false, constant.PathInvalid, "Path is a directory.", errors.New("path is a directory")
+		}
+		replaced = info.Size()
+	}
+	quotaRoot, account := c.quotaScope(name)
+	tracker, err := c.quota.Begin(quotaRoot, absPath, account, replaced, statErr != nil)
+	if errors.Is(err, ErrQuotaExceeded) {
+		return false, constant.ExceededStorage, "File count quota exceeded.", err
+	}
+	if err != nil {
+		return false, constant.LocalProcessingError, "Cannot compute storage usage.", err
+	}
+
+	// 与上传相同：写入临时文件后重命名
+	var file io.WriteCloser
+	tempPath, err := uploadTempPath(name)
+	if err == nil {
+		file, err = c.home.Create(tempPath)
+	}
+	if err == nil {
+		_, err = io.Copy(tracker.Writer(file), version)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil && statErr == nil {
+		err = c.versions.Save(absPath)
+	}
+	if err == nil {
+		err = c.home.Rename(tempPath, name)
+	}
+	if err != nil {
+		_ = c.home.Remove(tempPath)
+		tracker.Cancel()
+		if errors.Is(err, ErrQuotaExceeded) {
+			return false, constant.ExceededStorage, "Storage quota exceeded, restore aborted.", err
+		}
+		return false, constant.LocalProcessingError, "Failed to restore version.", err
+	}
+	c.log().Info("Version restored", "path", absPath, "version", args[1])
+
+	return true, constant.FileCommandRunSuccess, "Restored " + args[0] + " to version " + args[1] + ".", nil
+}
+
+// 重新加载服务端配置，仅管理员可用；配置有误时保持原配置并返回错误
+func (c *FTPConn) handleSiteRELOAD() (ok bool, code constant.Code, msg string, err error) {
+	if c.authorisation != constant.ADMIN {
+		return false, constant.PathInvalid, "Permission denied.", errors.New("reload requires admin")
+	}
+
+	if err := c.reloader.Reload(); err != nil {
+		// 回应为单行，多条错误以分号分隔
+		detail := strings.ReplaceAll(err.Error(), "\n", "; ")
+		return false, constant.LocalProcessingError, "Reload failed, config unchanged: " + detail, err
+	}
+	c.log().Info("Configuration reloaded by admin")
+
+	return true, constant.CommandRunSuccess, "Configuration reloaded.", nil
+}
+
+// 回收站：查看、恢复与清空
+// args: <list | restore [id] | empty>
+func (c *FTPConn) handleSiteTRASH(args []string) (ok bool, code constant.Code, msg string, err error) {
+	if len(args) == 0 {
+		return c.handleTrashLIST()
+	}
+
+	switch strings.ToLower(args[0]) {
+	case constant.LIST:
+		return c.handleTrashLIST()
+	case constant.RESTORE:
+		if len(args) != 2 {
+			return false, constant.CommandArgsError, "Invalid number of arguments.", nil
+		}
+		return c.handleTrashRESTORE(args[1])
+	case constant.EMPTY:
+		if err := c.trash.Empty(c.username); err != nil {
+			return false, constant.LocalProcessingError, "Failed to empty trash.", err
+		}
+		c.log().Info("Trash emptied")
+		return true, constant.CommandRunSuccess, "Trash emptied.", nil
+	default:
+		return false, constant.ParameterNotImplemented, "Unknown SITE TRASH command " + args[0] + ".", nil
+	}
+}
+
+// 列出回收站中的内容
+func (c *FTPConn) handleTrashLIST() (ok bool, code constant.Code, msg string, err error) {
+	items, err := c.trash.List(c.username)
+	if err != nil {
+		return false, constant.LocalProcessingError, "Cannot list trash.", err
+	}
+	if len(items) == 0 {
+		return true, constant.CommandRunSuccess, "Trash is empty.", nil
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d item(s) in trash:", len(items))
+	for _, item := range items {
+		kind := "file"
+		if item.IsDir {
+			kind = "dir"
+		}
+		fmt.Fprintf(&builder, " %s %s (%s, %d bytes);", item.ID, item.Origin, kind, item.Size)
+	}
+	return true, constant.CommandRunSuccess, strings.TrimSuffix(builder.String(), ";"), nil
+}
+
+// 将回收站中的一项恢复到删除前的位置，恢复的内容计入配额
+func (c *FTPConn) handleTrashRESTORE(id string) (ok bool, code constant.Code, msg string, err error) {
+	item, err := c.trash.Get(c.username, id)
+	if err != nil {
+		return false, constant.PathInvalid, "Trash item " + id + " does not exist.", err
+	}
+
+	name, err := c.resolve(item.Origin)
+	if err != nil {
+		return false, constant.PathInvalid, err.Error(), err
+	}
+	absPath := c.absPath(name)
+	if err := c.checkWritable(name); err != nil {
+		return false, constant.PathInvalid, err.Error(), err
+	}
+	unlock, err := c.locks.Lock(absPath)
+	if err != nil {
+		return false, constant.FileBusy, "File is busy, please retry later.", err
+	}
+	defer unlock()
+	if _, err := c.home.Stat(name); err == nil {
+		return false, constant.PathInvalid, item.Origin + " already exists.", errors.New("restore target exists")
+	}
+	if err := vfs.MkdirAll(c.home, path.Dir(name)); err != nil {
+		return false, constant.LocalProcessingError, "Cannot create parent directory.", err
+	}
+
+	bytes, files, err := diskUsage(c.fs, path.Join(c.trash.dir(c.username), id, trashData))
+	if err != nil {
+		return false, constant.LocalProcessingError, "Cannot compute storage usage.", err
+	}
+	quotaRoot, account := c.quotaScope(name)
+	err = c.quota.Reserve(quotaRoot, absPath, account, bytes, files)
+	if errors.Is(err, ErrQuotaExceeded) {
+		return false, constant.ExceededStorage, "Storage quota exceeded, cannot restore.", err
+	}
+	if err != nil {
+		return false, constant.LocalProcessingError, "Cannot compute storage usage.", err
+	}
+
+	if err := c.trash.Restore(c.username, id, absPath); err != nil {
+		c.quota.Update(absPath, -bytes, -files)
+		return false, constant.LocalProcessingError, "Failed to restore " + item.Origin + ".", err
+	}
+	c.log().Info("Restored from trash", "path", absPath)
+
+	return true, constant.FileCommandRunSuccess, "Restored " + item.Origin + ".", nil
+}
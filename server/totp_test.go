@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA-1 密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFCVectors(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 给出 8 位验证码，这里取后 6 位
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		if got := totpCode(key, tc.unix/totpPeriod); got != tc.code {
+			t.Errorf("T=%d: code = %s, want %s", tc.unix, got, tc.code)
+		}
+		if !verifyTOTPAt("rfc", rfcSecret, tc.code, time.Unix(tc.unix, 0)) {
+			t.Errorf("T=%d: verifyTOTP rejected %s", tc.unix, tc.code)
+		}
+	}
+}
+
+func TestTOTPWindow(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfcSecret)
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+
+	// 前后各一个时间步内的验证码有效，每个账号单独记录已使用的时间步
+	for i, offset := range []int64{-1, 0, 1} {
+		user := []string{"early", "current", "late"}[i]
+		if !verifyTOTPAt(user, rfcSecret, totpCode(key, step+offset), now) {
+			t.Errorf("code for step %+d rejected", offset)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		if verifyTOTPAt("outside", rfcSecret, totpCode(key, step+offset), now) {
+			t.Errorf("code for step %+d accepted", offset)
+		}
+	}
+
+	if verifyTOTPAt("format", rfcSecret, "12345", now) || verifyTOTPAt("format", "not base32!", totpCode(key, step), now) {
+		t.Error("malformed code or secret accepted")
+	}
+	// 小写、带填充的密钥同样可用
+	if !verifyTOTPAt("lower", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq====", totpCode(key, step), now) {
+		t.Error("lower-case secret rejected")
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfcSecret)
+	now := time.Unix(2000000000, 0)
+	step := now.Unix() / totpPeriod
+
+	code := totpCode(key, step)
+	if !verifyTOTPAt("replay", rfcSecret, code, now) {
+		t.Fatal("first use rejected")
+	}
+	if verifyTOTPAt("replay", rfcSecret, code, now) {
+		t.Error("same code accepted twice")
+	}
+	// 已用过较新的时间步后，较早时间步的验证码也不再有效
+	if verifyTOTPAt("replay", rfcSecret, totpCode(key, step-1), now) {
+		t.Error("code for an earlier step accepted after a later one")
+	}
+	if !verifyTOTPAt("replay", rfcSecret, totpCode(key, step+1), now) {
+		t.Error("code for the next step rejected")
+	}
+	// 其它账号不受影响
+	if !verifyTOTPAt("other", rfcSecret, code, now) {
+		t.Error("code rejected for another account")
+	}
+}
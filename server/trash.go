@@ -0,0 +1,162 @@
+package main
+
+import (
+	"GoFTP/vfs"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	TrashStore = "/" + ReservedPrefix + "trash" // 回收站目录，位于所有用户可见目录之外
+
+	trashOrigin = "origin" // 记录删除前用户可见路径的文件
+	trashData   = "data"   // 被删除的文件或目录
+)
+
+// Trash 按用户划分的回收站：/.goftp-trash/<username>/<id>/{origin,data}，id 为删除时间
+type Trash struct {
+	fs        vfs.FileSystem
+	Retention time.Duration // 保留时长，超时后自动清除；0 表示不使用回收站，直接删除
+}
+
+// TrashItem 回收站中的一项
+type TrashItem struct {
+	ID     string
+	Origin string // 删除前用户可见的路径
+	IsDir  bool
+	Size   int64
+}
+
+func NewTrash(fileSystem vfs.FileSystem, retention time.Duration) *Trash {
+	return &Trash{fs: fileSystem, Retention: retention}
+}
+
+// Enabled 是否启用回收站
+func (t *Trash) Enabled() bool {
+	return t.Retention > 0
+}
+
+// 用户的回收站目录
+func (t *Trash) dir(username string) string {
+	return path.Join(TrashStore, url.PathEscape(username))
+}
+
+// Put 将 name 移入用户的回收站，origin 为删除前用户可见的路径
+func (t *Trash) Put(username, name, origin string) error {
+	itemDir := path.Join(t.dir(username), time.Now().UTC().Format(versionIDTime))
+	if err := vfs.MkdirAll(t.fs, itemDir); err != nil {
+		return err
+	}
+
+	err := vfs.WriteFile(t.fs, path.Join(itemDir, trashOrigin), []byte(origin))
+	if err == nil {
+		err = t.fs.Rename(name, path.Join(itemDir, trashData))
+	}
+	if err != nil {
+		_ = vfs.RemoveAll(t.fs, itemDir)
+	}
+	return err
+}
+
+// List 列出用户回收站中的内容，最近删除的在前
+func (t *Trash) List(username string) ([]TrashItem, error) {
+	entries, err := t.fs.ReadDir(t.dir(username))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(b.Name(), a.Name()) })
+
+	var items []TrashItem
+	for _, entry := range entries {
+		item, err := t.Get(username, entry.Name())
+		if err != nil {
+			slog.Warn("Read trash item failed", "err", err)
+			continue
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// Get 读取回收站中的一项
+func (t *Trash) Get(username, id string) (*TrashItem, error) {
+	if _, err := time.Parse(versionIDTime, id); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: id, Err: fs.ErrNotExist}
+	}
+	itemDir := path.Join(t.dir(username), id)
+
+	origin, err := vfs.ReadFile(t.fs, path.Join(itemDir, trashOrigin))
+	if err != nil {
+		return nil, err
+	}
+	size, _, err := diskUsage(t.fs, path.Join(itemDir, trashData))
+	if err != nil {
+		return nil, err
+	}
+	info, err := t.fs.Stat(path.Join(itemDir, trashData))
+	if err != nil {
+		return nil, err
+	}
+	return &TrashItem{ID: id, Origin: string(origin), IsDir: info.IsDir(), Size: size}, nil
+}
+
+// Restore 将回收站中的一项移回 target
+func (t *Trash) Restore(username, id, target string) error {
+	itemDir := path.Join(t.dir(username), id)
+	if err := t.fs.Rename(path.Join(itemDir, trashData), target); err != nil {
+		return err
+	}
+	return vfs.RemoveAll(t.fs, itemDir)
+}
+
+// Empty 清空用户的回收站
+func (t *Trash) Empty(username string) error {
+	return vfs.RemoveAll(t.fs, t.dir(username))
+}
+
+// Purge 清除所有用户回收站中超过保留时长的内容
+func (t *Trash) Purge() {
+	users, err := t.fs.ReadDir(TrashStore)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		slog.Warn("Scan trash failed", "err", err)
+		return
+	}
+
+	for _, user := range users {
+		userDir := path.Join(TrashStore, user.Name())
+		items, err := t.fs.ReadDir(userDir)
+		if err != nil {
+			slog.Warn("Scan trash failed", "err", err)
+			continue
+		}
+		for _, item := range items {
+			deleted, err := time.Parse(versionIDTime, item.Name())
+			if err != nil || time.Since(deleted) <= t.Retention {
+				continue
+			}
+			if err := vfs.RemoveAll(t.fs, path.Join(userDir, item.Name())); err != nil {
+				slog.Warn("Purge trash item failed", "err", err)
+			}
+		}
+	}
+}
+
+// PurgeLoop 定期清理过期内容
+func (t *Trash) PurgeLoop(interval time.Duration) {
+	for {
+		t.Purge()
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"GoFTP/vfs"
+	"crypto/rand"
+	"encoding/hex"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+const (
+	ReservedPrefix     = ".goftp-"        // 服务端内部使用的文件名前缀，客户端不可见也不可访问
+	UploadTempPrefix   = ".goftp-upload-" // 上传中的临时文件
+	uploadTempRandSize = 8
+)
+
+// 判断路径中是否包含保留文件名
+func isReservedPath(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ReservedPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 与目标文件同目录的临时文件路径，保证重命名不跨目录
+func uploadTempPath(target string) (string, error) {
+	suffix := make([]byte, uploadTempRandSize)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return path.Join(path.Dir(target), UploadTempPrefix+hex.EncodeToString(suffix)), nil
+}
+
+// 启动时清理上次运行残留的临时上传文件
+func cleanupUploads(fileSystem vfs.FileSystem) {
+	var removed int
+	err := vfs.Walk(fileSystem, "/", func(name string, entry fs.DirEntry) error {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), UploadTempPrefix) {
+			return nil
+		}
+		if err := fileSystem.Remove(name); err != nil {
+			slog.Warn("Remove orphaned upload failed", "err", err)
+			return nil
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		slog.Warn("Scan for orphaned uploads failed", "err", err)
+	}
+	if removed > 0 {
+		slog.Info("Removed orphaned uploads", "count", removed)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"GoFTP/constant"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+
+	passwordIterations = 600000 // PBKDF2 迭代次数
+)
+
+// UserStore 用户存储，账号与客户端证书映射表保存在同一个 JSON 文件中
+type UserStore struct {
+	mu   sync.RWMutex
+	path string
+
+	Users        []*Account    `json:"users"`
+	Certificates []CertMapping `json:"certificates,omitempty"`
+}
+
+// Account 账号
+type Account struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`              // 口令哈希，格式见 hashPassword
+	Role       string `json:"role"`                  // admin 或 user
+	Home       string `json:"home,omitempty"`        // 相对于根目录的主目录，默认为 /<username>
+	Quota      int64  `json:"quota,omitempty"`       // 存储配额（字节），0 表示不限制
+	QuotaFiles int64  `json:"quota_files,omitempty"` // 文件数配额，0 表示不限制
+
+	Mounts []Mount `json:"mounts,omitempty"` // 挂载到用户视图中的其他目录
+
+	TOTPSecret string `json:"totp_secret,omitempty"` // 两步验证密钥（base32），为空表示未启用
+}
+
+// CertMapping 客户端证书到账号的映射，Fingerprint / CommonName / SAN 任一匹配即可
+type CertMapping struct {
+	Fingerprint string `json:"fingerprint,omitempty"` // 证书 DER 的 SHA-256 指纹
+	CommonName  string `json:"cn,omitempty"`          // Subject CN
+	SAN         string `json:"san,omitempty"`         // DNS / Email / URI 形式的 SAN
+	Username    string `json:"username"`
+}
+
+// LoadUserStore 读取用户文件，文件不存在时创建并写入默认管理员 admin/123456
+func LoadUserStore(path string) (*UserStore, error) {
+	s, err := readUserStore(path)
+	if os.IsNotExist(err) {
+		hash, err := hashPassword("123456")
+		if err != nil {
+			return nil, err
+		}
+		s = &UserStore{path: path}
+		s.Users = []*Account{{Username: "admin", Password: hash, Role: RoleAdmin}}
+		return s, s.save()
+	}
+	return s, err
+}
+
+// 读取已有的用户文件
+func readUserStore(path string) (*UserStore, error) {
+	s := &UserStore{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, a := range s.Users {
+		if a.Role != RoleAdmin && a.Role != RoleUser {
+			return nil, fmt.Errorf("user %q: unknown role %q", a.Username, a.Role)
+		}
+	}
+	return s, nil
+}
+
+// Reload 重新读取用户文件，已登录会话持有的账号不受影响；
+// 文件不存在时报错，不会重新创建默认管理员
+func (s *UserStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, err := readUserStore(s.path)
+	if err != nil {
+		return err
+	}
+	s.Users, s.Certificates = next.Users, next.Certificates
+	return nil
+}
+
+// 写回用户文件，调用方需持有锁或保证无并发
+func (s *UserStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, append(data, '\n'), 0600)
+}
+
+// Lookup 按用户名查找账号
+func (s *UserStore) Lookup(username string) *Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, a := range s.Users {
+		if a.Username == username {
+			return a
+		}
+	}
+	return nil
+}
+
+// Verify 校验用户名与密码，成功时返回账号
+func (s *UserStore) Verify(username, password string) (*Account, bool) {
+	a := s.Lookup(username)
+	if a == nil {
+		// 账号不存在时同样计算一次哈希，避免通过耗时枚举用户名
+		checkPassword(dummyHash, password)
+		return nil, false
+	}
+	return a, checkPassword(a.Password, password)
+}
+
+// TOTPSecret 账号的两步验证密钥，账号不存在或未启用时返回空串
+func (s *UserStore) TOTPSecret(username string) string {
+	if a := s.Lookup(username); a != nil {
+		return a.TOTPSecret
+	}
+	return ""
+}
+
+// SetTOTPSecret 设置账号的两步验证密钥并写回文件，secret 为空表示关闭
+func (s *UserStore) SetTOTPSecret(username, secret string) error {
+	return s.UpdateAccount(username, func(a *Account) error {
+		a.TOTPSecret = secret
+		return nil
+	})
+}
+
+// ChangePassword 实现 PasswordChanger
+func (s *UserStore) ChangePassword(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.Users {
+		if a.Username == username {
+			a.Password = hash
+			return s.save()
+		}
+	}
+	return fmt.Errorf("user %q not found", username)
+}
+
+// Accounts 实现 UserManager，返回全部账号的副本
+func (s *UserStore) Accounts() []Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accounts := make([]Account, len(s.Users))
+	for i, a := range s.Users {
+		accounts[i] = *a
+	}
+	return accounts
+}
+
+// CreateAccount 实现 UserManager，password 为明文口令
+func (s *UserStore) CreateAccount(account Account, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	account.Password = hash
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.ContainsFunc(s.Users, func(a *Account) bool { return a.Username == account.Username }) {
+		return ErrUserExists
+	}
+	s.Users = append(s.Users, &account)
+	return s.save()
+}
+
+// UpdateAccount 实现 UserManager；修改作用于副本，已登录会话持有的账号不受影响
+func (s *UserStore) UpdateAccount(username string, update func(*Account) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, a := range s.Users {
+		if a.Username == username {
+			updated := *a
+			if err := update(&updated); err != nil {
+				return err
+			}
+			s.Users[i] = &updated
+			return s.save()
+		}
+	}
+	return ErrUserNotFound
+}
+
+// DeleteAccount 实现 UserManager，已登录的会话不会被断开
+func (s *UserStore) DeleteAccount(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.Users, func(a *Account) bool { return a.Username == username })
+	if i < 0 {
+		return ErrUserNotFound
+	}
+	s.Users = slices.Delete(s.Users, i, i+1)
+	return s.save()
+}
+
+// Authenticate 实现 Authenticator
+func (s *UserStore) Authenticate(username, password, ip string) (*Account, error) {
+	account, ok := s.Verify(username, password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return account, nil
+}
+
+// MatchCertificate 查找已校验的客户端证书对应的账号
+func (s *UserStore) MatchCertificate(cert *x509.Certificate) *Account {
+	sum := sha256.Sum256(cert.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	sans := append([]string{}, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+
+	s.mu.RLock()
+	var username string
+	for _, m := range s.Certificates {
+		switch {
+		case m.Fingerprint != "" && normalizeFingerprint(m.Fingerprint) == fingerprint:
+		case m.CommonName != "" && m.CommonName == cert.Subject.CommonName:
+		case m.SAN != "" && slices.Contains(sans, m.SAN):
+		default:
+			continue
+		}
+		username = m.Username
+		break
+	}
+	s.mu.RUnlock()
+
+	if username == "" {
+		return nil
+	}
+	return s.Lookup(username)
+}
+
+// HomeDir 账号在存储驱动中的主目录，管理员为根目录
+func (a *Account) HomeDir() string {
+	switch {
+	case a.Role == RoleAdmin:
+		return "/"
+	case a.Home != "":
+		// 以 “/” 为基准清理，防止主目录配置中的 “..” 越出根目录
+		return path.Join("/", a.Home)
+	default:
+		return path.Join("/", a.Username)
+	}
+}
+
+// Status 账号角色对应的授权
+func (a *Account) Status() constant.Status {
+	if a.Role == RoleAdmin {
+		return constant.ADMIN
+	}
+	return constant.USER
+}
+
+// 指纹允许带冒号、大小写混用
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// 用户不存在时参与比较的哈希
+var dummyHash, _ = hashPassword("")
+
+// hashPassword 生成口令哈希，格式为 pbkdf2-sha256$<迭代次数>$<盐>$<哈希>
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// checkPassword 校验口令是否与哈希匹配
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err1 := enc.DecodeString(parts[2])
+	want, err2 := enc.DecodeString(parts[3])
+	if err := errors.Join(err1, err2); err != nil {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"GoFTP/vfs"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	VersionStore  = "/" + ReservedPrefix + "versions" // 历史版本存放目录，位于所有用户可见目录之外
+	versionIDTime = "20060102T150405.000000000Z"      // 版本号格式，按字典序即时间序
+)
+
+// VersionPolicy 目录的版本保留策略，对子目录同样生效
+type VersionPolicy struct {
+	Dir       string        // 存储驱动中的目录
+	Keep      int           // 保留最近的版本数，0 表示不按数量清理
+	Retention time.Duration // 保留时长，0 表示不按时间清理
+}
+
+// VersionPolicies 版本策略列表，可作为命令行参数重复指定：<dir>:<keep>[:<retention>] 或 <dir>:<retention>
+type VersionPolicies []VersionPolicy
+
+func (p *VersionPolicies) String() string {
+	var parts []string
+	for _, policy := range *p {
+		parts = append(parts, fmt.Sprintf("%s:%d:%s", policy.Dir, policy.Keep, policy.Retention))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *VersionPolicies) Set(value string) error {
+	fields := strings.Split(value, ":")
+	if len(fields) < 2 || len(fields) > 3 || fields[0] == "" {
+		return errors.New("expected <dir>:<keep>[:<retention>] or <dir>:<retention>")
+	}
+
+	policy := VersionPolicy{Dir: path.Clean("/" + fields[0])}
+	for _, field := range fields[1:] {
+		if keep, err := strconv.Atoi(field); err == nil && keep >= 0 {
+			policy.Keep = keep
+		} else if retention, err := time.ParseDuration(field); err == nil && retention >= 0 {
+			policy.Retention = retention
+		} else {
+			return fmt.Errorf("invalid keep count or retention %q", field)
+		}
+	}
+	if policy.Keep == 0 && policy.Retention == 0 {
+		return errors.New("keep count or retention is required")
+	}
+	*p = append(*p, policy)
+	return nil
+}
+
+// UnmarshalJSON 配置文件中为字符串数组，格式同命令行参数
+func (p *VersionPolicies) UnmarshalJSON(data []byte) error {
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*p = nil
+	for _, value := range values {
+		if err := p.Set(value); err != nil {
+			return fmt.Errorf("versioning %q: %w", value, err)
+		}
+	}
+	return nil
+}
+
+// 查找对文件生效的策略，多个目录匹配时取最深的一个
+func (p VersionPolicies) lookup(name string) *VersionPolicy {
+	var match *VersionPolicy
+	for i, policy := range p {
+		if policy.Dir == "/" || strings.HasPrefix(name, policy.Dir+"/") {
+			if match == nil || len(policy.Dir) > len(match.Dir) {
+				match = &p[i]
+			}
+		}
+	}
+	return match
+}
+
+// Versioner 覆盖文件前保存旧内容，并按策略清理历史版本
+type Versioner struct {
+	fs       vfs.FileSystem
+	policies VersionPolicies
+}
+
+func NewVersioner(fileSystem vfs.FileSystem, policies VersionPolicies) *Versioner {
+	return &Versioner{fs: fileSystem, policies: policies}
+}
+
+// Save 将文件当前内容保存为一个历史版本；未启用版本保留时不做任何事
+func (v *Versioner) Save(name string) error {
+	policy := v.policies.lookup(name)
+	if policy == nil {
+		return nil
+	}
+
+	dir := path.Join(VersionStore, name)
+	if err := vfs.MkdirAll(v.fs, dir); err != nil {
+		return err
+	}
+	// 复制而非移动，保证覆盖过程中读者始终能读到完整的旧文件
+	id := time.Now().UTC().Format(versionIDTime)
+	if err := copyFile(v.fs, name, path.Join(dir, id)); err != nil {
+		return err
+	}
+
+	v.prune(dir, policy)
+	return nil
+}
+
+// List 列出文件的历史版本，最新的在前
+func (v *Versioner) List(name string) ([]fs.FileInfo, error) {
+	entries, err := v.fs.ReadDir(path.Join(VersionStore, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []fs.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, info)
+	}
+	slices.SortFunc(versions, func(a, b fs.FileInfo) int { return strings.Compare(b.Name(), a.Name()) })
+	return versions, nil
+}
+
+// Open 打开文件的某个历史版本
+func (v *Versioner) Open(name, id string) (io.ReadSeekCloser, error) {
+	if _, err := time.Parse(versionIDTime, id); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: id, Err: fs.ErrNotExist}
+	}
+	return v.fs.Open(path.Join(VersionStore, name, id))
+}
+
+// 按数量与时长清理历史版本
+func (v *Versioner) prune(dir string, policy *VersionPolicy) {
+	entries, err := v.fs.ReadDir(dir)
+	if err != nil {
+		slog.Warn("List versions failed", "err", err)
+		return
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(b.Name(), a.Name()) })
+
+	for i, entry := range entries {
+		expired := policy.Keep > 0 && i >= policy.Keep
+		if created, err := time.Parse(versionIDTime, entry.Name()); err == nil && policy.Retention > 0 {
+			expired = expired || time.Since(created) > policy.Retention
+		}
+		if !expired {
+			continue
+		}
+		if err := v.fs.Remove(path.Join(dir, entry.Name())); err != nil {
+			slog.Warn("Remove expired version failed", "err", err)
+		}
+	}
+}
+
+// 在同一存储驱动内复制文件
+func copyFile(fileSystem vfs.FileSystem, src, dst string) error {
+	in, err := fileSystem.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := fileSystem.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = fileSystem.Remove(dst)
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+// WebhookAuthenticator 将用户名、密码与来源IP POST 到外部身份服务，由其决定是否放行
+type WebhookAuthenticator struct {
+	URL      string
+	Client   *http.Client  // 请求超时由 Client.Timeout 控制
+	CacheTTL time.Duration // 放行结果的缓存时长，0 表示不缓存
+
+	mu    sync.Mutex
+	cache map[string]webhookCacheEntry
+}
+
+type webhookRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	IP       string `json:"ip"`
+}
+
+type webhookResponse struct {
+	Allow      bool    `json:"allow"`
+	Role       string  `json:"role"`
+	Home       string  `json:"home"`
+	Quota      int64   `json:"quota"`
+	QuotaFiles int64   `json:"quota_files"`
+	Mounts     []Mount `json:"mounts"`
+}
+
+type webhookCacheEntry struct {
+	account *Account
+	expires time.Time
+}
+
+func NewWebhookAuthenticator(url string, timeout, cacheTTL time.Duration) *WebhookAuthenticator {
+	return &WebhookAuthenticator{
+		URL:      url,
+		Client:   &http.Client{Timeout: timeout},
+		CacheTTL: cacheTTL,
+		cache:    make(map[string]webhookCacheEntry),
+	}
+}
+
+func (w *WebhookAuthenticator) Authenticate(username, password, ip string) (*Account, error) {
+	// 缓存键为凭据的哈希，不在内存中保留明文密码
+	sum := sha256.Sum256([]byte(username + "\x00" + password + "\x00" + ip))
+	key := hex.EncodeToString(sum[:])
+
+	if account := w.cached(key); account != nil {
+		return account, nil
+	}
+
+	body, err := json.Marshal(webhookRequest{Username: username, Password: password, IP: ip})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("auth webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth webhook: unexpected status %s", resp.Status)
+	}
+
+	var result webhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("auth webhook: decode response: %w", err)
+	}
+	if !result.Allow {
+		return nil, ErrInvalidCredentials
+	}
+	if result.Role == "" {
+		result.Role = RoleUser
+	}
+	if result.Role != RoleAdmin && result.Role != RoleUser {
+		return nil, fmt.Errorf("auth webhook: unknown role %q", result.Role)
+	}
+	// 与管理接口一致，主目录与挂载点不能指向服务端保留的 .goftp- 路径
+	if result.Home != "" && isReservedPath(path.Join("/", result.Home)) {
+		return nil, fmt.Errorf("auth webhook: home %q is a reserved path", result.Home)
+	}
+	for _, m := range result.Mounts {
+		if _, ok := cleanMount(m); !ok {
+			return nil, fmt.Errorf("auth webhook: invalid mount %q at %q", m.Source, m.Path)
+		}
+	}
+
+	account := &Account{
+		Username:   username,
+		Role:       result.Role,
+		Home:       result.Home,
+		Quota:      result.Quota,
+		QuotaFiles: result.QuotaFiles,
+		Mounts:     result.Mounts,
+	}
+	w.store(key, account)
+	return account, nil
+}
+
+// 取出未过期的缓存结果
+func (w *WebhookAuthenticator) cached(key string) *Account {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entry, ok := w.cache[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(w.cache, key)
+		return nil
+	}
+	return entry.account
+}
+
+// 缓存放行结果，顺带清理过期条目
+func (w *WebhookAuthenticator) store(key string, account *Account) {
+	if w.CacheTTL <= 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range w.cache {
+		if now.After(entry.expires) {
+			delete(w.cache, k)
+		}
+	}
+	w.cache[key] = webhookCacheEntry{account: account, expires: now.Add(w.CacheTTL)}
+}
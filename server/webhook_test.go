@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 模拟身份服务：记录请求次数，按 handle 返回结果
+func newWebhookServer(t *testing.T, handle func(req webhookRequest) (int, any)) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req webhookRequest
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		status, body := handle(req)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestWebhookAllow(t *testing.T) {
+	server, _ := newWebhookServer(t, func(req webhookRequest) (int, any) {
+		if req.Username != "alice" || req.Password != "secret" || req.IP != "192.0.2.1" {
+			return http.StatusOK, webhookResponse{}
+		}
+		return http.StatusOK, webhookResponse{Allow: true, Role: RoleAdmin, Home: "/shared", Quota: 1024, QuotaFiles: 10}
+	})
+
+	auth := NewWebhookAuthenticator(server.URL, time.Second, 0)
+	account, err := auth.Authenticate("alice", "secret", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	want := Account{Username: "alice", Role: RoleAdmin, Home: "/shared", Quota: 1024, QuotaFiles: 10}
+	if account.Username != want.Username || account.Role != want.Role || account.Home != want.Home ||
+		account.Quota != want.Quota || account.QuotaFiles != want.QuotaFiles {
+		t.Errorf("account = %+v, want %+v", *account, want)
+	}
+}
+
+func TestWebhookDefaultRole(t *testing.T) {
+	server, _ := newWebhookServer(t, func(webhookRequest) (int, any) {
+		return http.StatusOK, webhookResponse{Allow: true}
+	})
+
+	account, err := NewWebhookAuthenticator(server.URL, time.Second, 0).Authenticate("bob", "pw", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if account.Role != RoleUser {
+		t.Errorf("role = %q, want %q", account.Role, RoleUser)
+	}
+}
+
+func TestWebhookDeny(t *testing.T) {
+	server, _ := newWebhookServer(t, func(webhookRequest) (int, any) {
+		return http.StatusOK, webhookResponse{Allow: false}
+	})
+
+	_, err := NewWebhookAuthenticator(server.URL, time.Second, time.Minute).Authenticate("alice", "wrong", "192.0.2.1")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestWebhookUnexpectedStatus(t *testing.T) {
+	server, _ := newWebhookServer(t, func(webhookRequest) (int, any) {
+		return http.StatusInternalServerError, map[string]string{"error": "down"}
+	})
+
+	_, err := NewWebhookAuthenticator(server.URL, time.Second, 0).Authenticate("alice", "secret", "192.0.2.1")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want backend error", err)
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server, _ := newWebhookServer(t, func(webhookRequest) (int, any) {
+		<-release
+		return http.StatusOK, webhookResponse{Allow: true}
+	})
+	defer close(release)
+
+	start := time.Now()
+	_, err := NewWebhookAuthenticator(server.URL, 50*time.Millisecond, 0).Authenticate("alice", "secret", "192.0.2.1")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Authenticate took %s, timeout not applied", elapsed)
+	}
+}
+
+func TestWebhookBadRole(t *testing.T) {
+	server, _ := newWebhookServer(t, func(webhookRequest) (int, any) {
+		return http.StatusOK, webhookResponse{Allow: true, Role: "root"}
+	})
+
+	account, err := NewWebhookAuthenticator(server.URL, time.Second, time.Minute).Authenticate("alice", "secret", "192.0.2.1")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) || account != nil {
+		t.Errorf("Authenticate = %v, %v; want unknown role error", account, err)
+	}
+}
+
+func TestWebhookReservedPaths(t *testing.T) {
+	for _, result := range []webhookResponse{
+		{Allow: true, Home: ReservedPrefix + "trash"},
+		{Allow: true, Home: "/alice/../" + ReservedPrefix + "versions/alice"},
+		{Allow: true, Mounts: []Mount{{Path: "/shared", Source: "/" + ReservedPrefix + "trash"}}},
+		{Allow: true, Mounts: []Mount{{Path: "/docs/" + ReservedPrefix + "upload-1", Source: "/shared"}}},
+		{Allow: true, Mounts: []Mount{{Path: "/", Source: "/shared"}}},
+	} {
+		server, calls := newWebhookServer(t, func(webhookRequest) (int, any) {
+			return http.StatusOK, result
+		})
+		auth := NewWebhookAuthenticator(server.URL, time.Second, time.Minute)
+
+		// 不合法的回应视为认证后端出错，不会放行，也不缓存
+		for range 2 {
+			account, err := auth.Authenticate("alice", "secret", "192.0.2.1")
+			if err == nil || errors.Is(err, ErrInvalidCredentials) || account != nil {
+				t.Errorf("home %q mounts %v: Authenticate = %v, %v; want backend error", result.Home, result.Mounts, account, err)
+			}
+		}
+		if n := calls.Load(); n != 2 {
+			t.Errorf("webhook called %d times, want 2", n)
+		}
+	}
+
+	server, _ := newWebhookServer(t, func(webhookRequest) (int, any) {
+		return http.StatusOK, webhookResponse{Allow: true, Home: "/teams/a", Mounts: []Mount{{Path: "/shared", Source: "/shared", ReadOnly: true}}}
+	})
+	account, err := NewWebhookAuthenticator(server.URL, time.Second, 0).Authenticate("alice", "secret", "192.0.2.1")
+	if err != nil || account.Home != "/teams/a" || len(account.Mounts) != 1 {
+		t.Errorf("Authenticate = %+v, %v; want home and mount accepted", account, err)
+	}
+}
+
+func TestWebhookCache(t *testing.T) {
+	server, calls := newWebhookServer(t, func(req webhookRequest) (int, any) {
+		return http.StatusOK, webhookResponse{Allow: req.Password == "secret"}
+	})
+	auth := NewWebhookAuthenticator(server.URL, time.Second, time.Minute)
+
+	for range 3 {
+		if _, err := auth.Authenticate("alice", "secret", "192.0.2.1"); err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("webhook called %d times, want 1 (cached)", n)
+	}
+
+	// 凭据或来源IP不同都不能命中缓存
+	if _, err := auth.Authenticate("alice", "other", "192.0.2.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("different password: err = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := auth.Authenticate("alice", "secret", "192.0.2.2"); err != nil {
+		t.Errorf("different ip: %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("webhook called %d times, want 3", n)
+	}
+
+	// 拒绝的结果不缓存
+	auth.Authenticate("alice", "other", "192.0.2.1")
+	if n := calls.Load(); n != 4 {
+		t.Errorf("webhook called %d times after a repeated denial, want 4", n)
+	}
+}
+
+func TestWebhookCacheExpires(t *testing.T) {
+	server, calls := newWebhookServer(t, func(webhookRequest) (int, any) {
+		return http.StatusOK, webhookResponse{Allow: true}
+	})
+	auth := NewWebhookAuthenticator(server.URL, time.Second, 20*time.Millisecond)
+
+	auth.Authenticate("alice", "secret", "192.0.2.1")
+	time.Sleep(40 * time.Millisecond)
+	auth.Authenticate("alice", "secret", "192.0.2.1")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("webhook called %d times, want 2 after expiry", n)
+	}
+}
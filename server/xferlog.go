@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransferLog 以 wu-ftpd / vsftpd 的 xferlog 格式记录每次上传与下载
+type TransferLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Transfer 一次已结束的传输
+type Transfer struct {
+	Start    time.Time
+	Remote   string // 来源IP
+	Bytes    int64
+	Path     string // 存储驱动中的绝对路径
+	Incoming bool   // 上传为 true
+	Username string
+	Complete bool // 为 false 表示传输中断
+}
+
+// OpenTransferLog 以追加方式打开传输日志文件
+func OpenTransferLog(name string) (*TransferLog, error) {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &TransferLog{file: file}, nil
+}
+
+// Record 追加一行 xferlog 记录，未启用传输日志（l 为 nil）时忽略
+//
+// 字段依次为：当前时间、传输秒数、远端主机、字节数、文件名、传输类型（b 二进制）、
+// 特殊处理（_ 无）、方向（i 上传 / o 下载）、访问方式（r 实名用户）、用户名、
+// 服务名、认证方式（0 无 RFC931）、认证用户ID（*）、完成状态（c 完成 / i 中断）
+func (l *TransferLog) Record(t Transfer) {
+	if l == nil {
+		return
+	}
+
+	now := time.Now()
+	seconds := int64(math.Ceil(now.Sub(t.Start).Seconds()))
+	direction, status := "o", "i"
+	if t.Incoming {
+		direction = "i"
+	}
+	if t.Complete {
+		status = "c"
+	}
+	// 文件名与用户名中的空白会破坏按空格分隔的字段，替换为下划线
+	line := fmt.Sprintf("%s %d %s %d %s b _ %s r %s ftp 0 * %s\n",
+		now.Format(time.ANSIC), seconds, t.Remote, t.Bytes, blankToUnderscore(t.Path),
+		direction, blankToUnderscore(t.Username), status)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.WriteString(line); err != nil {
+		slog.Warn("Write transfer log failed", "err", err)
+	}
+}
+
+// Close 关闭传输日志文件
+func (l *TransferLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+func blankToUnderscore(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// 记录本会话的一次传输到传输日志与指标
+func (c *FTPConn) logTransfer(start time.Time, name string, bytes int64, incoming, complete bool) {
+	c.metrics.Transfer(incoming, bytes, time.Since(start), complete)
+	c.transfers.Record(Transfer{
+		Start:    start,
+		Remote:   remoteIP(c.conn),
+		Bytes:    bytes,
+		Path:     name,
+		Incoming: incoming,
+		Username: c.username,
+		Complete: complete,
+	})
+}
@@ -0,0 +1,330 @@
+package vfs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sync"
+)
+
+const (
+	dedupFiles = "/files" // 用户可见的目录树，文件内容为指向数据块的引用
+	dedupBlobs = "/blobs" // 按 SHA-256 存放的文件内容
+	dedupTemp  = "/blobs/tmp"
+)
+
+// DedupFS 内容寻址的去重驱动：相同内容只在底层驱动中存储一次，
+// 用户可见的文件仅记录内容的 SHA-256；引用计数在启动时由目录树重建，计数归零时删除数据块
+type DedupFS struct {
+	*dedupStore
+	tree FileSystem // 用户可见的目录树，由底层驱动限定在 /files 或其子目录中
+}
+
+// 经 Sub 得到的各个驱动共享的数据块与引用计数
+type dedupStore struct {
+	mu      sync.Mutex
+	backing FileSystem
+	refs    map[string]int // 数据块 -> 引用数
+}
+
+// 引用文件的内容
+type dedupRef struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// NewDedupFS 在 backing 之上创建去重驱动，统计引用并清理无引用的数据块
+func NewDedupFS(backing FileSystem) (*DedupFS, error) {
+	if err := MkdirAll(backing, dedupFiles); err != nil {
+		return nil, err
+	}
+	if err := MkdirAll(backing, dedupTemp); err != nil {
+		return nil, err
+	}
+	tree, err := Sub(backing, dedupFiles)
+	if err != nil {
+		return nil, err
+	}
+	d := &DedupFS{dedupStore: &dedupStore{backing: backing, refs: make(map[string]int)}, tree: tree}
+
+	// 无法读取的引用文件记录日志后跳过，不影响启动
+	var skipped int
+	err = Walk(tree, "/", func(name string, entry fs.DirEntry) error {
+		if entry.IsDir() {
+			return nil
+		}
+		ref, err := d.readRef(name)
+		if err != nil {
+			slog.Warn("Skip unreadable blob reference", "name", name, "err", err)
+			skipped++
+			return nil
+		}
+		d.refs[ref.SHA256]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 清理未完成的写入与无引用的数据块；有引用文件被跳过时无法确定数据块是否仍被引用，只清理未完成的写入
+	if skipped > 0 {
+		slog.Warn("Keep unreferenced blobs because some references could not be read", "skipped", skipped)
+	}
+	err = Walk(backing, dedupBlobs, func(name string, entry fs.DirEntry) error {
+		if entry.IsDir() || d.refs[entry.Name()] > 0 {
+			return nil
+		}
+		if skipped > 0 && path.Dir(name) != dedupTemp {
+			return nil
+		}
+		slog.Info("Remove unreferenced blob", "name", name)
+		return backing.Remove(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// 虚拟路径在目录树中的位置
+func (d *DedupFS) treePath(name string) string {
+	return path.Clean("/" + name)
+}
+
+func blobPath(sum string) string {
+	return path.Join(dedupBlobs, sum[:2], sum)
+}
+
+func (d *DedupFS) readRef(treePath string) (*dedupRef, error) {
+	data, err := ReadFile(d.tree, treePath)
+	if err != nil {
+		return nil, err
+	}
+	ref := &dedupRef{}
+	if err := json.Unmarshal(data, ref); err != nil || len(ref.SHA256) != sha256.Size*2 {
+		return nil, &fs.PathError{Op: "open", Path: treePath, Err: errors.New("invalid blob reference")}
+	}
+	return ref, nil
+}
+
+// 读取 treePath 处文件的引用，路径不存在或为目录时返回 nil
+func (d *DedupFS) existingRef(treePath string) (*dedupRef, error) {
+	info, err := d.tree.Stat(treePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, nil
+	}
+	return d.readRef(treePath)
+}
+
+// 引用数减一，归零时删除数据块；调用方需持有锁
+func (d *DedupFS) release(sum string) {
+	d.refs[sum]--
+	if d.refs[sum] > 0 {
+		return
+	}
+	delete(d.refs, sum)
+	if err := d.backing.Remove(blobPath(sum)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Remove blob failed", "err", err)
+	}
+}
+
+func (d *DedupFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := d.tree.Stat(d.treePath(name))
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+	ref, err := d.readRef(d.treePath(name))
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: info.Name(), size: ref.Size, modTime: info.ModTime()}, nil
+}
+
+func (d *DedupFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := d.tree.ReadDir(d.treePath(name))
+	if err != nil {
+		return nil, err
+	}
+	// 文件大小取自引用而非引用文件本身
+	for i, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := d.Stat(path.Join(name, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries, nil
+}
+
+func (d *DedupFS) Open(name string) (io.ReadSeekCloser, error) {
+	ref, err := d.readRef(d.treePath(name))
+	if err != nil {
+		return nil, err
+	}
+	return d.backing.Open(blobPath(ref.SHA256))
+}
+
+// Create 先将内容写入临时数据块并计算摘要，关闭时再去重并写入引用
+func (d *DedupFS) Create(name string) (io.WriteCloser, error) {
+	info, err := d.tree.Stat(path.Dir(d.treePath(name)))
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: errors.New("not a directory")}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	temp := path.Join(dedupTemp, hex.EncodeToString(buf))
+	file, err := d.backing.Create(temp)
+	if err != nil {
+		return nil, err
+	}
+	return &dedupWriter{d: d, name: name, temp: temp, file: file, hash: sha256.New()}, nil
+}
+
+func (d *DedupFS) Rename(oldName, newName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	oldPath, newPath := d.treePath(oldName), d.treePath(newName)
+	if oldPath == newPath {
+		return nil
+	}
+	replaced, err := d.existingRef(newPath)
+	if err != nil {
+		return err
+	}
+	if err := d.tree.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	if replaced != nil {
+		d.release(replaced.SHA256)
+	}
+	return nil
+}
+
+func (d *DedupFS) Remove(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ref, err := d.existingRef(d.treePath(name))
+	if err != nil {
+		return err
+	}
+	if err := d.tree.Remove(d.treePath(name)); err != nil {
+		return err
+	}
+	if ref != nil {
+		d.release(ref.SHA256)
+	}
+	return nil
+}
+
+func (d *DedupFS) Mkdir(name string) error {
+	return d.tree.Mkdir(d.treePath(name))
+}
+
+// Sub 由底层驱动限定目录树的根目录，保留其对符号链接等的限制；数据块与引用计数仍与本驱动共享
+func (d *DedupFS) Sub(dir string) (FileSystem, error) {
+	tree, err := Sub(d.tree, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &DedupFS{dedupStore: d.dedupStore, tree: tree}, nil
+}
+
+func (d *DedupFS) Close() error {
+	if closer, ok := d.tree.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// 写入完成后：内容已存在则丢弃临时数据块，否则将其移动到摘要对应的位置；随后写入引用
+func (d *DedupFS) commit(name, temp string, ref *dedupRef) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	treePath := d.treePath(name)
+	replaced, err := d.existingRef(treePath)
+	if err != nil {
+		_ = d.backing.Remove(temp)
+		return err
+	}
+
+	if d.refs[ref.SHA256] > 0 {
+		err = d.backing.Remove(temp)
+	} else {
+		err = MkdirAll(d.backing, path.Dir(blobPath(ref.SHA256)))
+		if err == nil {
+			err = d.backing.Rename(temp, blobPath(ref.SHA256))
+		}
+	}
+	if err != nil {
+		_ = d.backing.Remove(temp)
+		return err
+	}
+
+	data, err := json.Marshal(ref)
+	if err == nil {
+		err = WriteFile(d.tree, treePath, data)
+	}
+	if err != nil {
+		if d.refs[ref.SHA256] == 0 {
+			_ = d.backing.Remove(blobPath(ref.SHA256))
+		}
+		return err
+	}
+
+	d.refs[ref.SHA256]++
+	if replaced != nil {
+		d.release(replaced.SHA256)
+	}
+	return nil
+}
+
+// 写入临时数据块的同时计算摘要
+type dedupWriter struct {
+	d    *DedupFS
+	name string
+	temp string
+	file io.WriteCloser
+	hash hash.Hash
+	size int64
+}
+
+func (w *dedupWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *dedupWriter) Close() error {
+	if err := w.file.Close(); err != nil {
+		_ = w.d.backing.Remove(w.temp)
+		return err
+	}
+	sum := hex.EncodeToString(w.hash.Sum(nil))
+	return w.d.commit(w.name, w.temp, &dedupRef{SHA256: sum, Size: w.size})
+}
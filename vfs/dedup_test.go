@@ -0,0 +1,198 @@
+package vfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"testing"
+)
+
+func newTestDedupFS(t *testing.T, backing FileSystem) *DedupFS {
+	t.Helper()
+	d, err := NewDedupFS(backing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// 底层驱动中已提交的数据块，按摘要排序
+func storedBlobs(t *testing.T, backing FileSystem) []string {
+	t.Helper()
+	var blobs []string
+	err := Walk(backing, dedupBlobs, func(name string, entry fs.DirEntry) error {
+		if !entry.IsDir() && path.Dir(name) != dedupTemp {
+			blobs = append(blobs, entry.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(blobs)
+	return blobs
+}
+
+func sumOf(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFiles(t *testing.T, fsys FileSystem, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		if err := WriteFile(fsys, name, []byte(data)); err != nil {
+			t.Fatalf("WriteFile(%s): %v", name, err)
+		}
+	}
+}
+
+func assertContent(t *testing.T, fsys FileSystem, files map[string]string) {
+	t.Helper()
+	for name, want := range files {
+		if data, err := ReadFile(fsys, name); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+}
+
+func assertBlobs(t *testing.T, backing FileSystem, contents ...string) {
+	t.Helper()
+	var want []string
+	for _, data := range contents {
+		want = append(want, sumOf(data))
+	}
+	slices.Sort(want)
+	if got := storedBlobs(t, backing); !slices.Equal(got, want) {
+		t.Errorf("blobs = %v, want %v", got, want)
+	}
+}
+
+func TestDedupSharesBlob(t *testing.T) {
+	backing := NewMemoryFS()
+	d := newTestDedupFS(t, backing)
+	d.Mkdir("/docs")
+	writeFiles(t, d, map[string]string{"/a.txt": "same", "/docs/b.txt": "same", "/c.txt": "other"})
+
+	assertContent(t, d, map[string]string{"/a.txt": "same", "/docs/b.txt": "same", "/c.txt": "other"})
+	assertBlobs(t, backing, "same", "other")
+	if info, err := d.Stat("/docs/b.txt"); err != nil || info.Size() != 4 {
+		t.Errorf("Stat = %v, %v; want size 4", info, err)
+	}
+}
+
+func TestDedupRemoveLastReference(t *testing.T) {
+	backing := NewMemoryFS()
+	d := newTestDedupFS(t, backing)
+	writeFiles(t, d, map[string]string{"/a.txt": "same", "/b.txt": "same"})
+
+	if err := d.Remove("/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertBlobs(t, backing, "same")
+	assertContent(t, d, map[string]string{"/b.txt": "same"})
+
+	if err := d.Remove("/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertBlobs(t, backing)
+	if err := d.Remove("/b.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("second Remove err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestDedupOverwriteReleasesOldBlob(t *testing.T) {
+	backing := NewMemoryFS()
+	d := newTestDedupFS(t, backing)
+	writeFiles(t, d, map[string]string{"/a.txt": "one", "/b.txt": "shared"})
+
+	writeFiles(t, d, map[string]string{"/a.txt": "two"})
+	assertContent(t, d, map[string]string{"/a.txt": "two"})
+	assertBlobs(t, backing, "two", "shared")
+
+	// 以相同内容覆盖不改变引用数
+	writeFiles(t, d, map[string]string{"/a.txt": "two"})
+	assertBlobs(t, backing, "two", "shared")
+
+	// 覆盖为其它文件已有的内容
+	writeFiles(t, d, map[string]string{"/a.txt": "shared"})
+	assertBlobs(t, backing, "shared")
+	d.Remove("/b.txt")
+	assertContent(t, d, map[string]string{"/a.txt": "shared"})
+	assertBlobs(t, backing, "shared")
+}
+
+func TestDedupRenameReleasesReplacedBlob(t *testing.T) {
+	backing := NewMemoryFS()
+	d := newTestDedupFS(t, backing)
+	d.Mkdir("/dir")
+	writeFiles(t, d, map[string]string{"/a.txt": "one", "/b.txt": "two", "/dir/c.txt": "three"})
+
+	if err := d.Rename("/a.txt", "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, d, map[string]string{"/b.txt": "one"})
+	if _, err := d.Stat("/a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(/a.txt) err = %v, want fs.ErrNotExist", err)
+	}
+	assertBlobs(t, backing, "one", "three")
+
+	// 移动目录不改变引用
+	if err := d.Rename("/dir", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, d, map[string]string{"/moved/c.txt": "three"})
+	assertBlobs(t, backing, "one", "three")
+	if err := d.Rename("/b.txt", "/b.txt"); err != nil {
+		t.Errorf("Rename onto itself: %v", err)
+	}
+	assertBlobs(t, backing, "one", "three")
+}
+
+// 启动时由目录树重建引用计数，清理无引用的数据块与未完成的写入
+func TestDedupRebuildsRefsAtStartup(t *testing.T) {
+	backing := NewMemoryFS()
+	writeFiles(t, newTestDedupFS(t, backing), map[string]string{"/a.txt": "same", "/b.txt": "same", "/c.txt": "other"})
+	orphan := blobPath(sumOf("orphan"))
+	MkdirAll(backing, path.Dir(orphan))
+	writeFiles(t, backing, map[string]string{orphan: "orphan", dedupTemp + "/partial": "partial"})
+
+	d := newTestDedupFS(t, backing)
+	assertBlobs(t, backing, "same", "other")
+	if _, err := backing.Stat(dedupTemp + "/partial"); err == nil {
+		t.Error("unfinished write kept")
+	}
+	assertContent(t, d, map[string]string{"/a.txt": "same", "/b.txt": "same", "/c.txt": "other"})
+
+	// 重建的计数包含两个引用，删除其中一个后数据块仍在
+	d.Remove("/a.txt")
+	assertBlobs(t, backing, "same", "other")
+	d.Remove("/b.txt")
+	assertBlobs(t, backing, "other")
+}
+
+// 有无法读取的引用时只清理未完成的写入，保留可能仍被引用的数据块
+func TestDedupStartupKeepsBlobsWithBadRef(t *testing.T) {
+	backing := NewMemoryFS()
+	writeFiles(t, newTestDedupFS(t, backing), map[string]string{"/a.txt": "kept"})
+	orphan := blobPath(sumOf("orphan"))
+	MkdirAll(backing, path.Dir(orphan))
+	writeFiles(t, backing, map[string]string{
+		orphan:                 "orphan",
+		dedupTemp + "/partial": "partial",
+		dedupFiles + "/broken": "not a reference",
+	})
+
+	d := newTestDedupFS(t, backing)
+	assertBlobs(t, backing, "kept", "orphan")
+	if _, err := backing.Stat(dedupTemp + "/partial"); err == nil {
+		t.Error("unfinished write kept")
+	}
+	assertContent(t, d, map[string]string{"/a.txt": "kept"})
+	if _, err := d.Open("/broken"); err == nil {
+		t.Error("Open(/broken) succeeded")
+	}
+}
@@ -0,0 +1,393 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// 加密文件格式：魔数 | 数据密钥的随机数 | 主密钥加密后的数据密钥 | 分块密文...
+// 每块明文 encChunkSize 字节，以数据密钥 AES-GCM 加密，随机数由块序号与是否为最后一块组成，
+// 因此可按偏移定位到任意块解密，截断或调换分块都会导致校验失败
+const (
+	encMagic      = "GOFTPEN1"
+	encKeySize    = 32
+	encNonceSize  = 12
+	encTagSize    = 16
+	encHeaderSize = len(encMagic) + encNonceSize + encKeySize + encTagSize
+	encChunkSize  = 64 * 1024
+	encBlockSize  = encChunkSize + encTagSize
+)
+
+// EncryptTempPrefix 原地加密时的临时文件名前缀，属于服务端保留的 .goftp- 前缀，客户端不可见
+const EncryptTempPrefix = ".goftp-encrypting-"
+
+// ErrNotEncrypted 文件不是加密格式
+var ErrNotEncrypted = errors.New("file is not encrypted")
+
+var errCorrupted = errors.New("encrypted file is corrupted")
+
+// EncryptedFS 静态加密驱动：每个文件使用随机的数据密钥加密，数据密钥由主密钥加密后存于文件头
+type EncryptedFS struct {
+	backing FileSystem
+	master  cipher.AEAD
+}
+
+// NewEncryptedFS 在 backing 之上创建加密驱动，key 为 32 字节主密钥
+func NewEncryptedFS(backing FileSystem, key []byte) (*EncryptedFS, error) {
+	master, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFS{backing: backing, master: master}, nil
+}
+
+// ReadKeyFile 读取主密钥文件，内容为 64 个十六进制字符（如 openssl rand -hex 32 生成）
+func ReadKeyFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != encKeySize {
+		return nil, errors.New("key file must contain 32 hex-encoded bytes")
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 分块的随机数：前 8 字节为块序号，最后一字节标记最后一块
+func chunkNonce(index int64, last bool) []byte {
+	nonce := make([]byte, encNonceSize)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if last {
+		nonce[encNonceSize-1] = 1
+	}
+	return nonce
+}
+
+// 密文长度对应的明文长度
+func plainSize(size int64) int64 {
+	body := size - int64(encHeaderSize)
+	if body < encTagSize {
+		return 0
+	}
+	chunks := (body + encBlockSize - 1) / encBlockSize
+	return body - chunks*encTagSize
+}
+
+// 读取文件头并解出数据密钥
+func (e *EncryptedFS) readHeader(r io.Reader) (cipher.AEAD, error) {
+	header := make([]byte, encHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrNotEncrypted
+	}
+	if string(header[:len(encMagic)]) != encMagic {
+		return nil, ErrNotEncrypted
+	}
+	nonce := header[len(encMagic) : len(encMagic)+encNonceSize]
+	key, err := e.master.Open(nil, nonce, header[len(encMagic)+encNonceSize:], []byte(encMagic))
+	if err != nil {
+		return nil, errors.New("cannot decrypt file key, wrong master key?")
+	}
+	return newGCM(key)
+}
+
+func (e *EncryptedFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := e.backing.Stat(name)
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+	return &fileInfo{name: info.Name(), size: plainSize(info.Size()), modTime: info.ModTime()}, nil
+}
+
+func (e *EncryptedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := e.backing.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	// 文件大小换算为明文大小
+	for i, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = fs.FileInfoToDirEntry(&fileInfo{name: info.Name(), size: plainSize(info.Size()), modTime: info.ModTime()})
+	}
+	return entries, nil
+}
+
+func (e *EncryptedFS) Open(name string) (io.ReadSeekCloser, error) {
+	file, err := e.backing.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.readHeader(file)
+	if err != nil {
+		file.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// 即使明文为空也有一个带校验的最后一块，不足一个校验标签说明文件被截断
+	body := size - int64(encHeaderSize)
+	if body < encTagSize {
+		file.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errCorrupted}
+	}
+	return &encReader{
+		file:   file,
+		aead:   aead,
+		size:   plainSize(size),
+		chunks: (body + encBlockSize - 1) / encBlockSize,
+		index:  -1,
+	}, nil
+}
+
+func (e *EncryptedFS) Create(name string) (io.WriteCloser, error) {
+	key := make([]byte, encKeySize)
+	nonce := make([]byte, encNonceSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := e.backing.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(encMagic), nonce...)
+	header = e.master.Seal(header, nonce, key, []byte(encMagic))
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &encWriter{file: file, aead: aead, buf: make([]byte, 0, encChunkSize)}, nil
+}
+
+func (e *EncryptedFS) Rename(oldName, newName string) error {
+	return e.backing.Rename(oldName, newName)
+}
+
+func (e *EncryptedFS) Remove(name string) error {
+	return e.backing.Remove(name)
+}
+
+func (e *EncryptedFS) Mkdir(name string) error {
+	return e.backing.Mkdir(name)
+}
+
+// Sub 由底层驱动限定根目录，保留其对符号链接等的限制
+func (e *EncryptedFS) Sub(dir string) (FileSystem, error) {
+	backing, err := Sub(e.backing, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFS{backing: backing, master: e.master}, nil
+}
+
+func (e *EncryptedFS) Close() error {
+	if closer, ok := e.backing.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// EncryptExisting 将底层驱动中的明文文件原地加密，已加密的文件保持不变，返回加密的文件数
+func (e *EncryptedFS) EncryptExisting() (int, error) {
+	var count int
+	err := Walk(e.backing, "/", func(name string, entry fs.DirEntry) error {
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		// 上次加密中断残留的临时文件
+		if strings.HasPrefix(entry.Name(), EncryptTempPrefix) {
+			return e.backing.Remove(name)
+		}
+		file, err := e.backing.Open(name)
+		if err != nil {
+			return err
+		}
+		magic := make([]byte, len(encMagic))
+		_, err = io.ReadFull(file, magic)
+		if bytes.Equal(magic, []byte(encMagic)) {
+			file.Close()
+			return nil
+		}
+		if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		// 写入同目录的临时文件后替换原文件
+		temp := path.Join(path.Dir(name), EncryptTempPrefix+path.Base(name))
+		w, err := e.Create(temp)
+		if err == nil {
+			_, err = io.Copy(w, file)
+			if closeErr := w.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		file.Close()
+		if err == nil {
+			err = e.backing.Rename(temp, name)
+		}
+		if err != nil {
+			_ = e.backing.Remove(temp)
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// 按块解密的读取器，支持任意偏移定位
+type encReader struct {
+	file   io.ReadSeekCloser
+	aead   cipher.AEAD
+	size   int64 // 明文大小
+	chunks int64
+	offset int64  // 明文读取位置
+	index  int64  // buf 对应的块序号，-1 表示未加载
+	buf    []byte // 当前块的明文
+}
+
+func (r *encReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		// 到达末尾前确认最后一块通过校验，否则截断后残留的不足一个校验标签的尾部不会被读取
+		if r.index != r.chunks-1 {
+			if err := r.load(r.chunks - 1); err != nil {
+				return 0, err
+			}
+		}
+		return 0, io.EOF
+	}
+	index := r.offset / encChunkSize
+	if index != r.index {
+		if err := r.load(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf[r.offset-index*encChunkSize:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// 读取并解密第 index 块
+func (r *encReader) load(index int64) error {
+	if _, err := r.file.Seek(int64(encHeaderSize)+index*encBlockSize, io.SeekStart); err != nil {
+		return err
+	}
+	block := make([]byte, encBlockSize)
+	n, err := io.ReadFull(r.file, block)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	plain, err := r.aead.Open(r.buf[:0], chunkNonce(index, index == r.chunks-1), block[:n], nil)
+	if err != nil {
+		r.index = -1
+		return errCorrupted
+	}
+	r.buf, r.index = plain, index
+	return nil
+}
+
+func (r *encReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *encReader) Close() error {
+	return r.file.Close()
+}
+
+// 按块加密的写入器；关闭时写入标记为最后一块的剩余数据（可能为空）
+type encWriter struct {
+	file  io.WriteCloser
+	aead  cipher.AEAD
+	buf   []byte
+	index int64
+	err   error
+}
+
+func (w *encWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	var written int
+	for len(p) > 0 {
+		// 缓冲已满且仍有数据，说明当前块不是最后一块
+		if len(w.buf) == encChunkSize {
+			if w.err = w.flush(false); w.err != nil {
+				return written, w.err
+			}
+		}
+		n := copy(w.buf[len(w.buf):encChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *encWriter) flush(last bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.index, last), w.buf, nil)
+	if _, err := w.file.Write(sealed); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	w.index++
+	return nil
+}
+
+func (w *encWriter) Close() error {
+	err := w.err
+	if err == nil {
+		err = w.flush(true)
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
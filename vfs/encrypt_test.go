@@ -0,0 +1,192 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func newTestEncryptedFS(t *testing.T) (*EncryptedFS, *MemoryFS) {
+	t.Helper()
+	backing := NewMemoryFS()
+	e, err := NewEncryptedFS(backing, bytes.Repeat([]byte{7}, encKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, backing
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	e, backing := newTestEncryptedFS(t)
+	for _, size := range []int{0, 1, encChunkSize, encChunkSize + 1, 3*encChunkSize + 100} {
+		data := randomBytes(t, size)
+		if err := WriteFile(e, "/file", data); err != nil {
+			t.Fatalf("size %d: WriteFile: %v", size, err)
+		}
+		got, err := ReadFile(e, "/file")
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("size %d: read back %d bytes, %v", size, len(got), err)
+		}
+		if info, err := e.Stat("/file"); err != nil || info.Size() != int64(size) {
+			t.Errorf("size %d: Stat = %v, %v", size, info, err)
+		}
+
+		raw, _ := ReadFile(backing, "/file")
+		chunks := max(1, (size+encChunkSize-1)/encChunkSize)
+		if want := encHeaderSize + size + chunks*encTagSize; len(raw) != want {
+			t.Errorf("size %d: stored %d bytes, want %d", size, len(raw), want)
+		}
+		if size >= 32 && bytes.Contains(raw, data[:32]) {
+			t.Errorf("size %d: plaintext stored on the backing driver", size)
+		}
+	}
+}
+
+func TestEncryptSeekAcrossChunks(t *testing.T) {
+	e, _ := newTestEncryptedFS(t)
+	data := randomBytes(t, 3*encChunkSize+100)
+	if err := WriteFile(e, "/file", data); err != nil {
+		t.Fatal(err)
+	}
+	r, err := e.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// 与 REST 偏移一样，从任意位置读到跨越块边界
+	for _, offset := range []int{0, encChunkSize - 1, encChunkSize, encChunkSize + 1, 2*encChunkSize - 10, 3 * encChunkSize, len(data) - 1} {
+		if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 20)
+		n, err := io.ReadFull(r, buf)
+		want := data[offset:min(offset+20, len(data))]
+		if !bytes.Equal(buf[:n], want) || (err != nil && n != len(want)) {
+			t.Errorf("offset %d: read %d bytes, %v", offset, n, err)
+		}
+	}
+
+	// 向后定位后读完剩余部分
+	if _, err := r.Seek(-encChunkSize-5, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(rest, data[len(data)-encChunkSize-5:]) {
+		t.Errorf("read from end = %d bytes, %v", len(rest), err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("read at end = %d, %v; want io.EOF", n, err)
+	}
+}
+
+func TestEncryptDetectsTampering(t *testing.T) {
+	data := randomBytes(t, 3*encChunkSize+100)
+	for name, tamper := range map[string]func(raw []byte) []byte{
+		"flipped byte": func(raw []byte) []byte {
+			raw[encHeaderSize+encBlockSize+10] ^= 1
+			return raw
+		},
+		"swapped chunks": func(raw []byte) []byte {
+			first := bytes.Clone(raw[encHeaderSize : encHeaderSize+encBlockSize])
+			copy(raw[encHeaderSize:], raw[encHeaderSize+encBlockSize:encHeaderSize+2*encBlockSize])
+			copy(raw[encHeaderSize+encBlockSize:], first)
+			return raw
+		},
+		"dropped last chunk": func(raw []byte) []byte {
+			return raw[:encHeaderSize+3*encBlockSize]
+		},
+		"cut inside a tag": func(raw []byte) []byte {
+			return raw[:encHeaderSize+encBlockSize+5]
+		},
+		"cut to an empty last chunk": func(raw []byte) []byte {
+			return raw[:encHeaderSize+encBlockSize+encTagSize]
+		},
+	} {
+		e, backing := newTestEncryptedFS(t)
+		if err := WriteFile(e, "/file", data); err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := ReadFile(backing, "/file")
+		WriteFile(backing, "/file", tamper(raw))
+		if got, err := ReadFile(e, "/file"); !errors.Is(err, errCorrupted) {
+			t.Errorf("%s: read %d bytes, err = %v; want corruption error", name, len(got), err)
+		}
+	}
+}
+
+// 截断到只剩文件头时不能当作空文件
+func TestEncryptHeaderOnly(t *testing.T) {
+	for _, size := range []int{0, encChunkSize} {
+		e, backing := newTestEncryptedFS(t)
+		if err := WriteFile(e, "/file", randomBytes(t, size)); err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := ReadFile(backing, "/file")
+		WriteFile(backing, "/file", raw[:encHeaderSize])
+		if _, err := e.Open("/file"); !errors.Is(err, errCorrupted) {
+			t.Errorf("size %d truncated to header: Open err = %v, want corruption error", size, err)
+		}
+	}
+}
+
+func TestEncryptWrongKey(t *testing.T) {
+	e, backing := newTestEncryptedFS(t)
+	if err := WriteFile(e, "/file", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEncryptedFS(backing, bytes.Repeat([]byte{8}, encKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(other, "/file"); err == nil {
+		t.Errorf("read with wrong key = %q, want error", data)
+	}
+
+	// 明文文件不能当作加密文件读取
+	WriteFile(backing, "/plain", []byte("plain text"))
+	if _, err := e.Open("/plain"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Open(plain) err = %v, want ErrNotEncrypted", err)
+	}
+}
+
+func TestEncryptExisting(t *testing.T) {
+	e, backing := newTestEncryptedFS(t)
+	MkdirAll(backing, "/docs")
+	WriteFile(backing, "/docs/plain.txt", []byte("plain text"))
+	WriteFile(backing, "/empty.txt", nil)
+	if err := WriteFile(e, "/done.txt", []byte("already encrypted")); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, _ := ReadFile(backing, "/done.txt")
+	// 上次中断留下的临时文件
+	WriteFile(backing, "/docs/"+EncryptTempPrefix+"plain.txt", []byte("partial"))
+
+	count, err := e.EncryptExisting()
+	if err != nil || count != 2 {
+		t.Fatalf("EncryptExisting = %d, %v; want 2", count, err)
+	}
+	for name, want := range map[string]string{"/docs/plain.txt": "plain text", "/empty.txt": "", "/done.txt": "already encrypted"} {
+		if data, err := ReadFile(e, name); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if raw, _ := ReadFile(backing, "/done.txt"); !bytes.Equal(raw, encrypted) {
+		t.Error("already encrypted file was rewritten")
+	}
+	if raw, _ := ReadFile(backing, "/docs/plain.txt"); strings.Contains(string(raw), "plain text") {
+		t.Error("file still stored in plain text")
+	}
+	entries, _ := backing.ReadDir("/docs")
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), EncryptTempPrefix) {
+			t.Errorf("temp file %s left behind", entry.Name())
+		}
+	}
+
+	if count, err := e.EncryptExisting(); err != nil || count != 0 {
+		t.Errorf("second EncryptExisting = %d, %v; want 0", count, err)
+	}
+}
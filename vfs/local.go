@@ -0,0 +1,86 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// LocalFS 本地磁盘驱动，虚拟路径映射到根目录下；基于 os.Root 解析路径，
+// “..”、指向根目录之外的符号链接以及解析过程中的目录替换都无法越出根目录
+type LocalFS struct {
+	root *os.Root
+}
+
+func NewLocalFS(dir string) (*LocalFS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalFS{root: root}, nil
+}
+
+// 虚拟路径转换为相对根目录的磁盘路径
+func (l *LocalFS) diskPath(name string) string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return "."
+	}
+	return filepath.FromSlash(name[1:])
+}
+
+func (l *LocalFS) Stat(name string) (fs.FileInfo, error) {
+	return l.root.Stat(l.diskPath(name))
+}
+
+func (l *LocalFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	dir, err := l.root.Open(l.diskPath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (l *LocalFS) Open(name string) (io.ReadSeekCloser, error) {
+	return l.root.Open(l.diskPath(name))
+}
+
+func (l *LocalFS) Create(name string) (io.WriteCloser, error) {
+	return l.root.Create(l.diskPath(name))
+}
+
+func (l *LocalFS) Rename(oldName, newName string) error {
+	return l.root.Rename(l.diskPath(oldName), l.diskPath(newName))
+}
+
+func (l *LocalFS) Remove(name string) error {
+	return l.root.Remove(l.diskPath(name))
+}
+
+func (l *LocalFS) Mkdir(name string) error {
+	return l.root.Mkdir(l.diskPath(name), 0755)
+}
+
+// Sub 以 dir 为根目录打开新的驱动，使用完毕后需关闭
+func (l *LocalFS) Sub(dir string) (FileSystem, error) {
+	root, err := l.root.OpenRoot(l.diskPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	return &LocalFS{root: root}, nil
+}
+
+func (l *LocalFS) Close() error {
+	return l.root.Close()
+}
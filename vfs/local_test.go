@@ -0,0 +1,217 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 磁盘布局：
+//
+//	<tmp>/outside/secret.txt     根目录之外的文件
+//	<tmp>/root/bob/own.txt
+//	<tmp>/root/bobby/secret.txt  与 bob 前缀相同的相邻目录
+func newEscapeTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{outside, filepath.Join(root, "bob"), filepath.Join(root, "bobby")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range map[string]string{
+		filepath.Join(outside, "secret.txt"):       "outside",
+		filepath.Join(root, "bob", "own.txt"):      "bob",
+		filepath.Join(root, "bobby", "secret.txt"): "bobby",
+	} {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, outside
+}
+
+// 以 /bob 为根目录的驱动
+func openBob(t *testing.T, root string) FileSystem {
+	t.Helper()
+	local, err := NewLocalFS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { local.Close() })
+	bob, err := Sub(local, "/bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bob.(*LocalFS).Close() })
+	return bob
+}
+
+// 所有读写操作都不能触及 name 指向的目标
+func assertNoAccess(t *testing.T, fsys FileSystem, name string) {
+	t.Helper()
+	if data, err := ReadFile(fsys, name); err == nil {
+		t.Errorf("ReadFile(%q) = %q, want error", name, data)
+	}
+	if _, err := fsys.Stat(name); err == nil {
+		t.Errorf("Stat(%q) succeeded", name)
+	}
+	if err := WriteFile(fsys, name, []byte("overwritten")); err == nil {
+		t.Errorf("WriteFile(%q) succeeded", name)
+	}
+	if err := fsys.Remove(name); err == nil {
+		t.Errorf("Remove(%q) succeeded", name)
+	}
+	if err := fsys.Rename("/own.txt", name); err == nil {
+		t.Errorf("Rename(/own.txt, %q) succeeded", name)
+		fsys.Rename(name, "/own.txt")
+	}
+}
+
+// 越界尝试之后，目标文件内容保持不变
+func assertUnchanged(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, want := range files {
+		if data, err := os.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestLocalSubSiblingPrefix(t *testing.T) {
+	root, _ := newEscapeTree(t)
+	bob := openBob(t, root)
+
+	// /bob 之下解析，不会落到前缀相同的 /bobby
+	for _, name := range []string{"/../bobby/secret.txt", "../bobby/secret.txt", "/bobby/secret.txt", "bobby/secret.txt"} {
+		assertNoAccess(t, bob, name)
+	}
+	if _, err := bob.ReadDir("/../bobby"); err == nil {
+		t.Error("ReadDir(/../bobby) succeeded")
+	}
+	assertUnchanged(t, map[string]string{filepath.Join(root, "bobby", "secret.txt"): "bobby"})
+}
+
+func TestLocalDotDotTraversal(t *testing.T) {
+	root, outside := newEscapeTree(t)
+	bob := openBob(t, root)
+
+	for _, name := range []string{"../outside/secret.txt", "../../outside/secret.txt", "/../../outside/secret.txt", "a/../../../outside/secret.txt"} {
+		assertNoAccess(t, bob, name)
+	}
+	// “..” 在根目录处停止，仍落在根目录内
+	if data, err := ReadFile(bob, "/../../own.txt"); err != nil || string(data) != "bob" {
+		t.Errorf("ReadFile(/../../own.txt) = %q, %v; want bob's own file", data, err)
+	}
+	if err := bob.Mkdir("../escaped"); err != nil {
+		t.Errorf("Mkdir(../escaped): %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped")); err == nil {
+		t.Error("Mkdir(../escaped) created a directory outside the sub tree")
+	}
+	assertUnchanged(t, map[string]string{filepath.Join(outside, "secret.txt"): "outside"})
+}
+
+func TestLocalAbsolutePaths(t *testing.T) {
+	root, outside := newEscapeTree(t)
+	bob := openBob(t, root)
+
+	// 绝对路径相对驱动的根目录解析，不是磁盘上的绝对路径
+	for _, name := range []string{filepath.ToSlash(filepath.Join(outside, "secret.txt")), "/etc/passwd"} {
+		if _, err := bob.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q): err = %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	assertUnchanged(t, map[string]string{filepath.Join(outside, "secret.txt"): "outside"})
+}
+
+func TestLocalSymlinks(t *testing.T) {
+	root, outside := newEscapeTree(t)
+	links := map[string]string{
+		"abs-file":    filepath.Join(outside, "secret.txt"),
+		"abs-dir":     outside,
+		"rel-dir":     filepath.Join("..", "..", "outside"),
+		"sibling-dir": filepath.Join("..", "bobby"),
+		"inside":      "own.txt", // 指向根目录内，允许访问
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, "bob", name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	bob := openBob(t, root)
+
+	// 指向外部文件的链接：读写都失败；删除或覆盖的只是链接本身，由最后的检查确认目标不变
+	if data, err := ReadFile(bob, "/abs-file"); err == nil {
+		t.Errorf("ReadFile(/abs-file) = %q, want error", data)
+	}
+	if err := WriteFile(bob, "/abs-file", []byte("overwritten")); err == nil {
+		t.Error("WriteFile(/abs-file) succeeded")
+	}
+	for _, name := range []string{"/abs-dir/secret.txt", "/rel-dir/secret.txt", "/sibling-dir/secret.txt"} {
+		assertNoAccess(t, bob, name)
+	}
+	for _, dir := range []string{"/abs-dir", "/rel-dir", "/sibling-dir"} {
+		if _, err := bob.ReadDir(dir); err == nil {
+			t.Errorf("ReadDir(%q) succeeded", dir)
+		}
+		if err := bob.Mkdir(dir + "/new"); err == nil {
+			t.Errorf("Mkdir(%q) succeeded", dir+"/new")
+		}
+	}
+	if data, err := ReadFile(bob, "/inside"); err != nil || string(data) != "bob" {
+		t.Errorf("ReadFile(/inside) = %q, %v; want link inside the root to work", data, err)
+	}
+
+	assertUnchanged(t, map[string]string{
+		filepath.Join(outside, "secret.txt"):       "outside",
+		filepath.Join(root, "bobby", "secret.txt"): "bobby",
+	})
+	if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+		t.Error("directory created outside the root through a symlink")
+	}
+}
+
+// 去重驱动的子目录同样由底层驱动限定，目录树中的符号链接无法越出用户目录
+func TestDedupSubSymlink(t *testing.T) {
+	dir := t.TempDir()
+	local, err := NewLocalFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	dedup, err := NewDedupFS(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/alice", "/bob"} {
+		if err := dedup.Mkdir(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteFile(dedup, "/alice/secret.txt", []byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "alice"), filepath.Join(dir, "files", "bob", "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	bob, err := Sub(dedup, "/bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.(*DedupFS).Close()
+	if data, err := ReadFile(bob, "/link/secret.txt"); err == nil {
+		t.Errorf("ReadFile through symlink = %q, want error", data)
+	}
+	if err := WriteFile(bob, "/own.txt", []byte("bob")); err != nil {
+		t.Errorf("WriteFile inside sub tree: %v", err)
+	}
+	if data, err := ReadFile(dedup, "/bob/own.txt"); err != nil || string(data) != "bob" {
+		t.Errorf("file written through sub = %q, %v", data, err)
+	}
+}
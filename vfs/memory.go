@@ -0,0 +1,216 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryFS 内存驱动，用于测试与临时部署，进程退出后内容丢失
+type MemoryFS struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode // 键为清理后的虚拟路径
+}
+
+type memNode struct {
+	dir     bool
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemoryFS() *MemoryFS {
+	return &MemoryFS{
+		nodes: map[string]*memNode{"/": {dir: true, modTime: time.Now()}},
+	}
+}
+
+func (m *MemoryFS) Stat(name string) (fs.FileInfo, error) {
+	name = path.Clean("/" + name)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return node.info(name), nil
+}
+
+func (m *MemoryFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = path.Clean("/" + name)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !node.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	var entries []fs.DirEntry
+	for p, child := range m.nodes {
+		if p != "/" && path.Dir(p) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(child.info(p)))
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (m *MemoryFS) Open(name string) (io.ReadSeekCloser, error) {
+	name = path.Clean("/" + name)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	// 读取的是打开时的快照，写入会替换 data 而不修改原切片
+	return nopCloser{bytes.NewReader(node.data)}, nil
+}
+
+func (m *MemoryFS) Create(name string) (io.WriteCloser, error) {
+	name = path.Clean("/" + name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkParent("create", name); err != nil {
+		return nil, err
+	}
+	if node, ok := m.nodes[name]; ok && node.dir {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: errors.New("is a directory")}
+	}
+	m.nodes[name] = &memNode{modTime: time.Now()}
+	return &memWriter{fs: m, name: name}, nil
+}
+
+func (m *MemoryFS) Rename(oldName, newName string) error {
+	oldName, newName = path.Clean("/"+oldName), path.Clean("/"+newName)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[oldName]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrNotExist}
+	}
+	if err := m.checkParent("rename", newName); err != nil {
+		return err
+	}
+	if target, ok := m.nodes[newName]; ok && (target.dir || node.dir) {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrExist}
+	}
+	if node.dir && strings.HasPrefix(newName, oldName+"/") {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrInvalid}
+	}
+
+	// 目录需连同子孙节点一起移动
+	for p, n := range m.nodes {
+		if p == oldName || strings.HasPrefix(p, oldName+"/") {
+			delete(m.nodes, p)
+			m.nodes[newName+strings.TrimPrefix(p, oldName)] = n
+		}
+	}
+	return nil
+}
+
+func (m *MemoryFS) Remove(name string) error {
+	name = path.Clean("/" + name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[name]
+	if !ok || name == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.dir {
+		for p := range m.nodes {
+			if strings.HasPrefix(p, name+"/") {
+				return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *MemoryFS) Mkdir(name string) error {
+	name = path.Clean("/" + name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.nodes[name]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if err := m.checkParent("mkdir", name); err != nil {
+		return err
+	}
+	m.nodes[name] = &memNode{dir: true, modTime: time.Now()}
+	return nil
+}
+
+// 检查父目录存在，调用方需持有锁
+func (m *MemoryFS) checkParent(op, name string) error {
+	parent, ok := m.nodes[path.Dir(name)]
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.dir {
+		return &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+	}
+	return nil
+}
+
+// 节点信息快照，调用方需持有锁
+func (n *memNode) info(name string) fs.FileInfo {
+	return &fileInfo{name: path.Base(name), dir: n.dir, size: int64(len(n.data)), modTime: n.modTime}
+}
+
+// 写入缓冲，关闭时提交到文件
+type memWriter struct {
+	fs   *MemoryFS
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	node, ok := w.fs.nodes[w.name]
+	if !ok || node.dir {
+		return &fs.PathError{Op: "close", Path: w.name, Err: fs.ErrNotExist}
+	}
+	node.data = w.buf.Bytes()
+	node.modTime = time.Now()
+	return nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,187 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrCrossMount 不支持跨挂载点重命名
+var ErrCrossMount = errors.New("cannot rename across mount points")
+
+// MountFS 将多个驱动组合为一棵目录树：未被挂载的路径由根驱动处理，
+// 挂载点及其下的路径由对应驱动处理；挂载点的上级目录不存在时视为空目录
+type MountFS struct {
+	root   FileSystem
+	mounts []*mountPoint // 按路径由深到浅排列
+}
+
+type mountPoint struct {
+	dir      string
+	fsys     FileSystem
+	readOnly bool
+}
+
+func NewMountFS(root FileSystem) *MountFS {
+	return &MountFS{root: root}
+}
+
+// Mount 将 fsys 挂载到 dir，readOnly 时拒绝写入
+func (m *MountFS) Mount(dir string, fsys FileSystem, readOnly bool) {
+	m.mounts = append(m.mounts, &mountPoint{dir: path.Clean("/" + dir), fsys: fsys, readOnly: readOnly})
+	slices.SortFunc(m.mounts, func(a, b *mountPoint) int { return len(b.dir) - len(a.dir) })
+}
+
+// 路径所在的挂载点及其在挂载驱动中的路径，不在任何挂载点下时返回 nil
+func (m *MountFS) lookup(name string) (*mountPoint, string) {
+	name = path.Clean("/" + name)
+	for _, mp := range m.mounts {
+		if name == mp.dir {
+			return mp, "/"
+		}
+		if strings.HasPrefix(name, mp.dir+"/") {
+			return mp, strings.TrimPrefix(name, mp.dir)
+		}
+	}
+	return nil, name
+}
+
+func (m *MountFS) resolve(name string) (FileSystem, string) {
+	mp, rest := m.lookup(name)
+	if mp == nil {
+		return m.root, rest
+	}
+	return mp.fsys, rest
+}
+
+// 可写时返回对应驱动
+func (m *MountFS) writable(op, name string) (FileSystem, string, error) {
+	mp, rest := m.lookup(name)
+	if mp == nil {
+		return m.root, rest, nil
+	}
+	if mp.readOnly {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	if rest == "/" {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: errors.New("is a mount point")}
+	}
+	return mp.fsys, rest, nil
+}
+
+// 直接位于 dir 下、通向挂载点的子目录名
+func (m *MountFS) mountChildren(dir string) []string {
+	dir = path.Clean("/" + dir)
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	var names []string
+	for _, mp := range m.mounts {
+		if !strings.HasPrefix(mp.dir, prefix) {
+			continue
+		}
+		child, _, _ := strings.Cut(strings.TrimPrefix(mp.dir, prefix), "/")
+		if !slices.Contains(names, child) {
+			names = append(names, child)
+		}
+	}
+	return names
+}
+
+func (m *MountFS) Stat(name string) (fs.FileInfo, error) {
+	fsys, rest := m.resolve(name)
+	info, err := fsys.Stat(rest)
+	if errors.Is(err, fs.ErrNotExist) && fsys == m.root && len(m.mountChildren(name)) > 0 {
+		return &fileInfo{name: path.Base(name), dir: true, modTime: time.Now()}, nil
+	}
+	return info, err
+}
+
+func (m *MountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, rest := m.resolve(name)
+	entries, err := fsys.ReadDir(rest)
+	children := m.mountChildren(name)
+	if fsys != m.root || len(children) == 0 {
+		return entries, err
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// 通向挂载点的目录覆盖根驱动中的同名项
+	entries = slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+		return slices.Contains(children, entry.Name())
+	})
+	for _, child := range children {
+		info, err := m.Stat(path.Join(name, child))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(&fileInfo{name: child, dir: true, modTime: info.ModTime()}))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (m *MountFS) Open(name string) (io.ReadSeekCloser, error) {
+	fsys, rest := m.resolve(name)
+	return fsys.Open(rest)
+}
+
+func (m *MountFS) Create(name string) (io.WriteCloser, error) {
+	fsys, rest, err := m.writable("create", name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.Create(rest)
+}
+
+func (m *MountFS) Rename(oldName, newName string) error {
+	oldMount, _ := m.lookup(oldName)
+	newMount, _ := m.lookup(newName)
+	if oldMount != newMount {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: ErrCrossMount}
+	}
+	fsys, oldRest, err := m.writable("rename", oldName)
+	if err != nil {
+		return err
+	}
+	_, newRest, err := m.writable("rename", newName)
+	if err != nil {
+		return err
+	}
+	return fsys.Rename(oldRest, newRest)
+}
+
+func (m *MountFS) Remove(name string) error {
+	fsys, rest, err := m.writable("remove", name)
+	if err != nil {
+		return err
+	}
+	return fsys.Remove(rest)
+}
+
+func (m *MountFS) Mkdir(name string) error {
+	fsys, rest, err := m.writable("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return fsys.Mkdir(rest)
+}
+
+// Close 关闭根驱动与各挂载驱动
+func (m *MountFS) Close() error {
+	var errs []error
+	if closer, ok := m.root.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	for _, mp := range m.mounts {
+		if closer, ok := mp.fsys.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,590 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 进程内的 S3 兼容服务，实现驱动用到的 HEAD / GET（含 Range）/ PUT / 复制 /
+// DELETE / ListObjectsV2 与分片上传（含分片复制），供测试使用，无需访问云服务
+type fakeS3 struct {
+	bucket      string
+	pageSize    int // ListObjectsV2 每页的最大条目数，用于测试分页
+	maxCopySize int // 单次 CopyObject 允许的对象大小
+
+	mu       sync.Mutex
+	objects  map[string]fakeObject
+	uploads  map[string]map[int][]byte // uploadId -> 分片
+	ranges   []string                  // 收到的 Range 请求头
+	requests []string                  // 收到的请求，格式为 "<method> <query>"
+}
+
+type fakeObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3FS) {
+	t.Helper()
+	f := &fakeS3{
+		bucket:      "test-bucket",
+		pageSize:    1000,
+		maxCopySize: s3MaxCopySize,
+		objects:     make(map[string]fakeObject),
+		uploads:     make(map[string]map[int][]byte),
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	s, err := NewS3FS(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    f.bucket,
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "secret",
+		PartSize:  s3MinPartSize,
+		Client:    server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, s
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	// 校验签名头是否齐全，以及负载摘要与请求体一致
+	sum := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		fakeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.RawQuery)
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && query.Get("list-type") == "2":
+		f.list(w, query)
+	case r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("Last-Modified", object.modTime.UTC().Format(http.TimeFormat))
+	case r.Method == http.MethodGet:
+		f.get(w, r, key)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.complete(w, key, query.Get("uploadId"), body)
+	case r.Method == http.MethodPut && query.Has("uploadId") && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.uploadPartCopy(w, r)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source := strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"+f.bucket+"/")
+		object, ok := f.objects[source]
+		if !ok {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if len(object.data) > f.maxCopySize {
+			fakeS3Error(w, http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		f.objects[key] = fakeObject{data: bytes.Clone(object.data), modTime: time.Now()}
+		fmt.Fprint(w, "<CopyObjectResult></CopyObjectResult>")
+	case r.Method == http.MethodPut:
+		f.objects[key] = fakeObject{data: body, modTime: time.Now()}
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	object, ok := f.objects[key]
+	if !ok {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	spec := r.Header.Get("Range")
+	if spec == "" {
+		w.Write(object.data)
+		return
+	}
+	f.ranges = append(f.ranges, spec)
+
+	var start, end int
+	if _, err := fmt.Sscanf(spec, "bytes=%d-%d", &start, &end); err != nil || start > end || start >= len(object.data) {
+		fakeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+		return
+	}
+	end = min(end, len(object.data)-1)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(object.data)))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(object.data[start : end+1])
+}
+
+// UploadPartCopy：以源对象的一段作为分片，ETag 在响应体中返回
+func (f *fakeS3) uploadPartCopy(w http.ResponseWriter, r *http.Request) {
+	parts, ok := f.uploads[r.URL.Query().Get("uploadId")]
+	if !ok {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	object, ok := f.objects[strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"+f.bucket+"/")]
+	if !ok {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	var start, end int
+	spec := r.Header.Get("X-Amz-Copy-Source-Range")
+	if _, err := fmt.Sscanf(spec, "bytes=%d-%d", &start, &end); err != nil || start > end || end >= len(object.data) || end-start+1 > f.maxCopySize {
+		fakeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+	number, _ := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	parts[number] = bytes.Clone(object.data[start : end+1])
+	fmt.Fprintf(w, "<CopyPartResult><ETag>&quot;etag-%d&quot;</ETag></CopyPartResult>", number)
+}
+
+// CompleteMultipartUpload：按请求中的分片顺序拼接，除最后一片外不得小于 5 MiB
+func (f *fakeS3) complete(w http.ResponseWriter, key, id string, body []byte) {
+	parts, ok := f.uploads[id]
+	if !ok {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	var request struct {
+		Parts []s3Part `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil || len(request.Parts) == 0 {
+		fakeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var data []byte
+	for i, part := range request.Parts {
+		chunk, ok := parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, part.PartNumber) {
+			fakeS3Error(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		if i < len(request.Parts)-1 && len(chunk) < s3MinPartSize {
+			fakeS3Error(w, http.StatusBadRequest, "EntityTooSmall")
+			return
+		}
+		data = append(data, chunk...)
+	}
+	delete(f.uploads, id)
+	f.objects[key] = fakeObject{data: data, modTime: time.Now()}
+	fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+}
+
+// ListObjectsV2，continuation-token 为上一页最后一个条目
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	prefix, delimiter, token := query.Get("prefix"), query.Get("delimiter"), query.Get("continuation-token")
+	maxKeys, _ := strconv.Atoi(query.Get("max-keys"))
+	maxKeys = min(maxKeys, f.pageSize)
+
+	// 对象与公共前缀按字典序合并成一个列表
+	type entry struct {
+		key    string
+		prefix bool
+	}
+	var entries []entry
+	seen := map[string]bool{}
+	for _, key := range slices.Sorted(maps.Keys(f.objects)) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					entries = append(entries, entry{common, true})
+				}
+				continue
+			}
+		}
+		entries = append(entries, entry{key, false})
+	}
+	if token != "" {
+		i := slices.IndexFunc(entries, func(e entry) bool { return e.key > token })
+		if i < 0 {
+			i = len(entries)
+		}
+		entries = entries[i:]
+	}
+
+	var b strings.Builder
+	b.WriteString("<ListBucketResult>")
+	truncated := len(entries) > maxKeys
+	if truncated {
+		entries = entries[:maxKeys]
+		fmt.Fprintf(&b, "<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", xmlText(entries[len(entries)-1].key))
+	}
+	for _, e := range entries {
+		if e.prefix {
+			fmt.Fprintf(&b, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", xmlText(e.key))
+			continue
+		}
+		object := f.objects[e.key]
+		fmt.Fprintf(&b, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>",
+			xmlText(e.key), len(object.data), object.modTime.UTC().Format(time.RFC3339))
+	}
+	b.WriteString("</ListBucketResult>")
+	io.WriteString(w, b.String())
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func fakeS3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, ok := f.objects[key]
+	return object.data, ok
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	rand.Read(data)
+	return data
+}
+
+func TestS3WriteAndRead(t *testing.T) {
+	f, s := newFakeS3(t)
+
+	if err := WriteFile(s, "/docs/a.txt", []byte("hello")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if data, ok := f.object("docs/a.txt"); !ok || string(data) != "hello" {
+		t.Fatalf("object docs/a.txt = %q, %v", data, ok)
+	}
+
+	info, err := s.Stat("/docs/a.txt")
+	if err != nil || info.IsDir() || info.Size() != 5 {
+		t.Fatalf("Stat = %v, %v", info, err)
+	}
+	if info, err := s.Stat("/docs"); err != nil || !info.IsDir() {
+		t.Fatalf("Stat dir = %v, %v", info, err)
+	}
+	data, err := ReadFile(s, "/docs/a.txt")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("ReadFile = %q, %v", data, err)
+	}
+
+	if _, err := s.Stat("/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat missing: err = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := s.Open("/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open missing: err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestS3RangedRead(t *testing.T) {
+	f, s := newFakeS3(t)
+	content := randomBytes(t, s3ReadChunkSize+1000)
+	f.objects["big.bin"] = fakeObject{data: content, modTime: time.Now()}
+
+	// 超过一个分段的对象分多次 Range 请求读取
+	data, err := ReadFile(s, "/big.bin")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("ReadFile = %d bytes, %v; want %d bytes", len(data), err, len(content))
+	}
+	want := []string{
+		fmt.Sprintf("bytes=0-%d", s3ReadChunkSize-1),
+		fmt.Sprintf("bytes=%d-%d", s3ReadChunkSize, len(content)-1),
+	}
+	if !slices.Equal(f.ranges, want) {
+		t.Errorf("ranges = %v, want %v", f.ranges, want)
+	}
+
+	// Seek 后从新位置发起 Range 请求
+	f.ranges = nil
+	file, err := s.Open("/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := io.ReadAll(file)
+	if err != nil || !bytes.Equal(tail, content[len(content)-10:]) {
+		t.Fatalf("read after seek = %x, %v", tail, err)
+	}
+	if want := []string{fmt.Sprintf("bytes=%d-%d", len(content)-10, len(content)-1)}; !slices.Equal(f.ranges, want) {
+		t.Errorf("ranges after seek = %v, want %v", f.ranges, want)
+	}
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	f, s := newFakeS3(t)
+	content := randomBytes(t, 2*s3MinPartSize+12345)
+
+	w, err := s.Create("/upload.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分多次小块写入，驱动自行攒满分片
+	for chunk := range slices.Chunk(content, 100_000) {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if data, ok := f.object("upload.bin"); !ok || !bytes.Equal(data, content) {
+		t.Fatalf("object = %d bytes, %v; want %d bytes", len(data), ok, len(content))
+	}
+	var parts int
+	for _, request := range f.requests {
+		if strings.HasPrefix(request, "PUT partNumber=") {
+			parts++
+		}
+	}
+	if parts != 3 {
+		t.Errorf("uploaded %d parts, want 3", parts)
+	}
+	if len(f.uploads) != 0 {
+		t.Errorf("%d multipart uploads left open", len(f.uploads))
+	}
+}
+
+func TestS3SmallFileUsesSinglePut(t *testing.T) {
+	f, s := newFakeS3(t)
+	if err := WriteFile(s, "/small.txt", []byte("tiny")); err != nil {
+		t.Fatal(err)
+	}
+	if slices.ContainsFunc(f.requests, func(r string) bool { return strings.HasPrefix(r, "POST") }) {
+		t.Errorf("small file started a multipart upload: %v", f.requests)
+	}
+}
+
+func TestS3ReadDir(t *testing.T) {
+	f, s := newFakeS3(t)
+	f.pageSize = 2 // 强制分页
+	for _, name := range []string{"/b.txt", "/a.txt", "/dir/x.txt", "/dir/sub/y.txt", "/z.txt"} {
+		if err := WriteFile(s, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Mkdir("/empty"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	entries, err := s.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		got = append(got, name)
+	}
+	if want := []string{"a.txt", "b.txt", "dir/", "empty/", "z.txt"}; !slices.Equal(got, want) {
+		t.Errorf("ReadDir(/) = %v, want %v", got, want)
+	}
+
+	// 目录标记不作为条目出现
+	if entries, err := s.ReadDir("/empty"); err != nil || len(entries) != 0 {
+		t.Errorf("ReadDir(/empty) = %v, %v; want empty", entries, err)
+	}
+	if _, err := s.ReadDir("/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadDir missing: err = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := s.ReadDir("/a.txt"); err == nil {
+		t.Error("ReadDir on a file succeeded")
+	}
+}
+
+func TestS3Rename(t *testing.T) {
+	f, s := newFakeS3(t)
+	WriteFile(s, "/a.txt", []byte("a"))
+	WriteFile(s, "/dir/x.txt", []byte("x"))
+	WriteFile(s, "/dir/sub/y.txt", []byte("y"))
+
+	if err := s.Rename("/a.txt", "/b.txt"); err != nil {
+		t.Fatalf("Rename file: %v", err)
+	}
+	if _, ok := f.object("a.txt"); ok {
+		t.Error("source object kept after rename")
+	}
+	if data, _ := f.object("b.txt"); string(data) != "a" {
+		t.Errorf("renamed object = %q", data)
+	}
+
+	// 目录重命名逐个移动前缀下的对象
+	if err := s.Rename("/dir", "/moved"); err != nil {
+		t.Fatalf("Rename dir: %v", err)
+	}
+	for key, want := range map[string]string{"moved/x.txt": "x", "moved/sub/y.txt": "y"} {
+		if data, ok := f.object(key); !ok || string(data) != want {
+			t.Errorf("object %s = %q, %v", key, data, ok)
+		}
+	}
+	if _, err := s.Stat("/dir"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat old dir: err = %v, want fs.ErrNotExist", err)
+	}
+
+	if err := s.Rename("/moved", "/moved/inner"); err == nil {
+		t.Error("renaming a directory into itself succeeded")
+	}
+	if err := s.Rename("/missing", "/x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Rename missing: err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+// 超过单次复制上限的对象改用分片复制
+func TestS3RenameLargeObject(t *testing.T) {
+	f, s := newFakeS3(t)
+	f.maxCopySize, s.maxCopySize = s3MinPartSize, s3MinPartSize
+	content := randomBytes(t, 2*s3MinPartSize+12345)
+	f.objects["big.bin"] = fakeObject{data: content, modTime: time.Now()}
+	f.objects["dir/big.bin"] = fakeObject{data: content, modTime: time.Now()}
+
+	if err := s.Rename("/big.bin", "/moved.bin"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if data, ok := f.object("moved.bin"); !ok || !bytes.Equal(data, content) {
+		t.Errorf("renamed object = %d bytes, %v; want %d bytes", len(data), ok, len(content))
+	}
+	if _, ok := f.object("big.bin"); ok {
+		t.Error("source object kept after rename")
+	}
+	if err := s.Rename("/dir", "/other"); err != nil {
+		t.Fatalf("Rename dir: %v", err)
+	}
+	if data, ok := f.object("other/big.bin"); !ok || !bytes.Equal(data, content) {
+		t.Errorf("object in renamed dir = %d bytes, %v", len(data), ok)
+	}
+	if len(f.uploads) != 0 {
+		t.Errorf("%d multipart uploads left open", len(f.uploads))
+	}
+
+	// 复制失败时放弃分片上传，源对象保持不变
+	f.maxCopySize = s3MinPartSize - 1
+	if err := s.Rename("/moved.bin", "/again.bin"); err == nil {
+		t.Error("Rename succeeded although part copy failed")
+	}
+	if _, ok := f.object("moved.bin"); !ok {
+		t.Error("source object removed after failed copy")
+	}
+	if len(f.uploads) != 0 {
+		t.Errorf("%d multipart uploads left open after failure", len(f.uploads))
+	}
+}
+
+func TestS3Remove(t *testing.T) {
+	f, s := newFakeS3(t)
+	WriteFile(s, "/dir/x.txt", []byte("x"))
+	s.Mkdir("/empty")
+
+	if err := s.Remove("/dir"); err == nil {
+		t.Error("removing a non-empty directory succeeded")
+	}
+	if err := s.Remove("/dir/x.txt"); err != nil {
+		t.Fatalf("Remove file: %v", err)
+	}
+	if err := s.Remove("/empty"); err != nil {
+		t.Fatalf("Remove empty dir: %v", err)
+	}
+	if _, ok := f.object("empty/"); ok {
+		t.Error("directory marker kept after remove")
+	}
+	if err := s.Remove("/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Remove missing: err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestS3Prefix(t *testing.T) {
+	f, s := newFakeS3(t)
+	s.cfg.Prefix = "ftp/root"
+
+	if err := WriteFile(s, "/a.txt", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.object("ftp/root/a.txt"); !ok {
+		t.Errorf("objects = %v, want key under prefix", slices.Sorted(maps.Keys(f.objects)))
+	}
+	if entries, err := s.ReadDir("/"); err != nil || len(entries) != 1 || entries[0].Name() != "a.txt" {
+		t.Errorf("ReadDir(/) = %v, %v", entries, err)
+	}
+}
+
+func TestS3SpecialCharactersInKey(t *testing.T) {
+	f, s := newFakeS3(t)
+	name := "/报告 2024/a+b&c=d.txt"
+	if err := WriteFile(s, name, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.object(strings.TrimPrefix(name, "/")); !ok {
+		t.Error("object with special characters not stored under its key")
+	}
+	if data, err := ReadFile(s, name); err != nil || string(data) != "x" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	if entries, err := s.ReadDir("/报告 2024"); err != nil || len(entries) != 1 || entries[0].Name() != "a+b&c=d.txt" {
+		t.Errorf("ReadDir = %v, %v", entries, err)
+	}
+}
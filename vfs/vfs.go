@@ -0,0 +1,194 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// FileSystem 存储驱动。路径均为以 “/” 开头、以 “/” 分隔的虚拟路径，“/” 为驱动的根目录
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Open(name string) (io.ReadSeekCloser, error)
+	Create(name string) (io.WriteCloser, error) // 文件已存在时截断
+	Rename(oldName, newName string) error
+	Remove(name string) error // 删除文件或空目录
+	Mkdir(name string) error
+}
+
+// SubFS 可自行限定根目录的驱动
+type SubFS interface {
+	Sub(dir string) (FileSystem, error)
+}
+
+// Sub 返回以 dir 为根目录的驱动，所有路径都无法越出 dir；
+// 驱动实现了 SubFS 时由驱动自行限定，否则在路径前拼接 dir。返回值实现 io.Closer 时需由调用方关闭
+func Sub(fsys FileSystem, dir string) (FileSystem, error) {
+	dir = path.Clean("/" + dir)
+	if sub, ok := fsys.(SubFS); ok {
+		return sub.Sub(dir)
+	}
+	if dir == "/" {
+		return fsys, nil
+	}
+	return &subFS{fsys: fsys, dir: dir}, nil
+}
+
+// 按路径前缀限定根目录，适用于没有符号链接的驱动
+type subFS struct {
+	fsys FileSystem
+	dir  string
+}
+
+func (s *subFS) join(name string) string {
+	return path.Join(s.dir, path.Clean("/"+name))
+}
+
+func (s *subFS) Stat(name string) (fs.FileInfo, error) {
+	return s.fsys.Stat(s.join(name))
+}
+
+func (s *subFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return s.fsys.ReadDir(s.join(name))
+}
+
+func (s *subFS) Open(name string) (io.ReadSeekCloser, error) {
+	return s.fsys.Open(s.join(name))
+}
+
+func (s *subFS) Create(name string) (io.WriteCloser, error) {
+	return s.fsys.Create(s.join(name))
+}
+
+func (s *subFS) Rename(oldName, newName string) error {
+	return s.fsys.Rename(s.join(oldName), s.join(newName))
+}
+
+func (s *subFS) Remove(name string) error {
+	return s.fsys.Remove(s.join(name))
+}
+
+func (s *subFS) Mkdir(name string) error {
+	return s.fsys.Mkdir(s.join(name))
+}
+
+// MkdirAll 逐级创建目录，目录已存在时不报错
+func MkdirAll(fsys FileSystem, name string) error {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil
+	}
+
+	info, err := fsys.Stat(name)
+	if err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := MkdirAll(fsys, path.Dir(name)); err != nil {
+		return err
+	}
+	if err := fsys.Mkdir(name); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// 非磁盘驱动使用的文件信息
+type fileInfo struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.dir }
+func (i *fileInfo) Sys() any           { return nil }
+
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// Walk 深度优先遍历目录树，fn 对 root 之下的每个文件与目录各调用一次；对目录返回 fs.SkipDir 则跳过其内容
+func Walk(fsys FileSystem, root string, fn func(name string, entry fs.DirEntry) error) error {
+	entries, err := fsys.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := path.Join(root, entry.Name())
+		if err := fn(name, entry); err != nil {
+			if err == fs.SkipDir && entry.IsDir() {
+				continue
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if err := Walk(fsys, name, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveAll 递归删除文件或目录，路径不存在时不报错
+func RemoveAll(fsys FileSystem, name string) error {
+	info, err := fsys.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := RemoveAll(fsys, path.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return fsys.Remove(name)
+}
+
+// WriteFile 写入小文件
+func WriteFile(fsys FileSystem, name string, data []byte) error {
+	file, err := fsys.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ReadFile 读取小文件
+func ReadFile(fsys FileSystem, name string) ([]byte, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}